@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// Collection tiers, sources of a tier are refreshed at most once per minimum
+// refresh interval of the tier, otherwise the cached metrics are served
+const (
+	tierFast = "fast"
+	tierSlow = "slow"
+)
+
+// source is a single source of metrics like the state of a C5 daemon
+type source struct {
+	name       string
+	tier       string
+	url        string
+	sequential bool // C5 counter queries must not be processed in parallel
+	fetch      func(fc *fetchContext, wg *sync.WaitGroup)
+
+	mtx         sync.Mutex
+	set         *metrics.Set
+	lastRefresh time.Time
+
+	// Result of the last refresh, guarded by statusMtx to be available during a refresh
+	statusMtx sync.Mutex
+	status    sourceStatus
+	debug     *sourceDebug
+}
+
+// sourceStatus is the result of the last refresh of a source
+type sourceStatus struct {
+	Refreshed time.Time
+	Duration  time.Duration
+	Errors    []string
+}
+
+func (st sourceStatus) polled() bool {
+	return !st.Refreshed.IsZero()
+}
+
+func (st sourceStatus) ok() bool {
+	return st.polled() && len(st.Errors) == 0
+}
+
+// refresh fetches the metrics of the source unless the cached metrics are
+// younger than the given interval
+func (s *source) refresh(interval time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.set != nil && time.Since(s.lastRefresh) < interval {
+		slog.Debug("Using cached metrics", "source", s.name)
+		return
+	}
+	fc := newFetchContext(s)
+	if config.AppConfig.DebugSourcesEnabled {
+		fc.debug = &sourceDebug{}
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.fetch(fc, &wg)
+	wg.Wait()
+	s.set = fc.set
+	s.lastRefresh = time.Now()
+
+	s.statusMtx.Lock()
+	s.status = sourceStatus{s.lastRefresh, s.lastRefresh.Sub(start), fc.fetchErrors()}
+	s.debug = fc.debug
+	s.statusMtx.Unlock()
+	if s.status.ok() {
+		resetRepeatedErrors(s)
+	}
+}
+
+func (s *source) lastStatus() sourceStatus {
+	s.statusMtx.Lock()
+	defer s.statusMtx.Unlock()
+	return s.status
+}
+
+func (s *source) lastDebug() *sourceDebug {
+	s.statusMtx.Lock()
+	defer s.statusMtx.Unlock()
+	return s.debug
+}
+
+func (s *source) metricSet() *metrics.Set {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.set
+}
+
+type collector struct {
+	sources   []*source
+	intervals map[string]time.Duration
+
+	mtx         sync.Mutex
+	running     map[uint64]time.Time // Start time of the running collects by collect id
+	lastCollect uint64               // Id of the last started collect
+}
+
+func newCollector(conf *config.AppConfiguration, sources []*source) *collector {
+	c := &collector{
+		sources: sources,
+		intervals: map[string]time.Duration{
+			tierFast: conf.FastTierInterval,
+			tierSlow: conf.SlowTierInterval,
+		},
+	}
+	for _, s := range sources {
+		if tier, ok := conf.SourceTiers[s.name]; ok {
+			if _, valid := c.intervals[tier]; !valid {
+				logError("Ignoring unknown tier", tier, "for source", s.name)
+				continue
+			}
+			s.tier = tier
+		}
+		logDebug("source", s.name, "assigned to tier", s.tier)
+	}
+	return c
+}
+
+// collect refreshes all sources of the given tiers and returns them. Sequential
+// sources are refreshed one after another once all other sources are done.
+func (c *collector) collect(tiers []string) (sources []*source) {
+	defer c.startCollect()()
+	for _, s := range c.sources {
+		for _, tier := range tiers {
+			if s.tier == tier {
+				sources = append(sources, s)
+				break
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range sources {
+		if !s.sequential {
+			wg.Add(1)
+			go func(s *source) {
+				defer wg.Done()
+				s.refresh(c.intervals[s.tier])
+			}(s)
+		}
+	}
+	wg.Wait()
+	for _, s := range sources {
+		if s.sequential {
+			s.refresh(c.intervals[s.tier])
+		}
+	}
+	return
+}
+
+// startCollect registers a running collect, the returned function unregisters it
+func (c *collector) startCollect() (done func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.running == nil {
+		c.running = make(map[uint64]time.Time)
+	}
+	c.lastCollect++
+	id := c.lastCollect
+	c.running[id] = time.Now()
+	return func() {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		delete(c.running, id)
+	}
+}
+
+// oldestCollect returns the start time of the longest running collect, ok is false
+// if no collect is running
+func (c *collector) oldestCollect() (started time.Time, ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, t := range c.running {
+		if !ok || t.Before(started) {
+			started, ok = t, true
+		}
+	}
+	return
+}
+
+// collectAll refreshes the sources of all tiers, used once at startup to know the
+// status of the sources before the first scrape
+func (c *collector) collectAll() {
+	tiers := make([]string, 0, len(c.intervals))
+	for tier := range c.intervals {
+		tiers = append(tiers, tier)
+	}
+	c.collect(tiers)
+}
+
+// writePrometheus collects the sources of the given tiers and writes their metrics
+func (c *collector) writePrometheus(w io.Writer, tiers []string) {
+	var sets []*metrics.Set
+	for _, s := range c.collect(tiers) {
+		if set := s.metricSet(); set != nil {
+			sets = append(sets, set)
+		}
+	}
+	writeMetricSets(w, sets)
+}
+
+// HELP text by metric name, metrics.Set does not support descriptions
+var gMetricHelp map[string]string
+var helpMtx sync.RWMutex
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func setMetricHelp(name, help string) {
+	helpMtx.Lock()
+	defer helpMtx.Unlock()
+	if gMetricHelp == nil {
+		gMetricHelp = make(map[string]string)
+	}
+	gMetricHelp[name] = help
+}
+
+func getMetricHelp(name string) (help string, ok bool) {
+	helpMtx.RLock()
+	defer helpMtx.RUnlock()
+	help, ok = gMetricHelp[name]
+	return
+}
+
+// metricFamily returns the metric name of a series line without labels and value
+func metricFamily(line string) string {
+	if i := strings.IndexAny(line, "{ "); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// writeMetricSets writes the metrics of all sets sorted by name. Series set by more
+// than one source (e.g. <prefix>_up) are written once using the value of the first set.
+// Series of the same metric are grouped and preceded by the HELP text if registered.
+func writeMetricSets(w io.Writer, sets []*metrics.Set) {
+	var buf bytes.Buffer
+	var lines []string
+	seen := make(map[string]string)
+	for _, set := range sets {
+		buf.Reset()
+		set.WritePrometheus(&buf)
+		for _, line := range strings.Split(buf.String(), "\n") {
+			sep := strings.LastIndexByte(line, ' ')
+			if sep < 0 {
+				continue
+			}
+			// Series like <prefix>_up are set by all sources of a daemon, the
+			// first value wins but differing values must not go unnoticed
+			series, value := line[:sep], line[sep+1:]
+			if first, ok := seen[series]; ok {
+				if first != value {
+					logWarn("Ignoring conflicting value", value, "of", series, "exported with value", first)
+				}
+				continue
+			}
+			seen[series] = value
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return metricFamily(lines[i]) < metricFamily(lines[j])
+	})
+	family := ""
+	for _, line := range lines {
+		if f := metricFamily(line); f != family {
+			family = f
+			if help, ok := getMetricHelp(family); ok {
+				io.WriteString(w, "# HELP "+family+" "+helpEscaper.Replace(help)+"\n")
+			}
+		}
+		io.WriteString(w, line+"\n")
+	}
+}
+
+// buildSources creates the metric sources of the enabled daemons, trunks, counter
+// queries, service providers and XMS targets with their default tier
+func buildSources(conf *config.AppConfiguration, daemons []config.DaemonConfig, counterQueries []counterQuery, xmsTargets []config.XmsTarget) (sources []*source) {
+	// --- C5 Metrics
+	for _, d := range daemons {
+		d := d
+		sources = append(sources, &source{name: d.Prefix, tier: tierFast, url: d.StateURL,
+			fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+				defer wg.Done()
+				// Process metrics require the cluster attributes of the daemon state
+				var inner sync.WaitGroup
+				inner.Add(1)
+				fetchC5StateMetrics(fc, d, &inner)
+				if conf.ProcessMetricsEnabled {
+					inner.Add(1)
+					fetchC5ProcessMetrics(fc, d, &inner)
+				}
+				inner.Wait()
+			}})
+		if d.Hazelcast {
+			sources = append(sources, &source{name: d.Prefix + "_hazelcast", tier: tierFast, url: d.BaseURL,
+				fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+					fetchC5HazelcastMetrics(fc, d, conf, wg)
+				}})
+		}
+	}
+
+	// Trunks are served by the main endpoint if enabled, otherwise with the service providers
+	if conf.SIPProxydTrunksEnabled || conf.SIPProxydExtEnabled {
+		tier := tierSlow
+		if conf.SIPProxydTrunksEnabled {
+			tier = tierFast
+		}
+		sources = append(sources, &source{name: "sipproxyd_trunks", tier: tier, url: conf.SIPProxydTrunkStatsURL, sequential: true,
+			fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+				fetchC5TrunkMetrics(fc, conf, wg)
+			}})
+	}
+	for _, q := range counterQueries {
+		q := q
+		sources = append(sources, &source{name: q.prefix + "_counter_" + strconv.FormatUint(uint64(q.id), 10), tier: tierFast, url: q.url, sequential: true,
+			fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+				fetchC5CounterMetrics(fc, q.prefix, q.table, q.label, q.url, q.tls, wg)
+			}})
+	}
+	if conf.SIPProxydExtEnabled {
+		sources = append(sources,
+			&source{name: "sipproxyd_sp_local", tier: tierSlow, url: conf.SIPProxydSPCountersURL,
+				fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+					fetchServiceProviderCounters(fc, "sipproxyd", "local", conf.SIPProxydSPCountersURL, conf.C5TLS, wg)
+				}},
+			&source{name: "sipproxyd_sp_cluster", tier: tierSlow, url: conf.SIPProxydClSPCountersURL,
+				fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+					fetchServiceProviderCounters(fc, "sipproxyd", "cluster", conf.SIPProxydClSPCountersURL, conf.C5TLS, wg)
+				}})
+	}
+
+	// --- XMS5 Metrics
+	for _, t := range xmsTargets {
+		t := t
+		fetchXms := fetchXmsMetrics
+		if t.Version == "v2" {
+			fetchXms = fetchXmsV2Metrics
+		}
+		for _, endpoint := range []string{xmsCounters, xmsLicenses} {
+			endpoint := endpoint
+			url := t.CountersURL
+			if endpoint == xmsLicenses {
+				url = t.LicensesURL
+			}
+			if url == "" {
+				continue
+			}
+			sources = append(sources, &source{name: t.Name + "_" + endpoint, tier: tierFast, url: url,
+				fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+					fetchXms(fc, t, endpoint, wg)
+				}})
+		}
+		for _, name := range t.Collectors {
+			name := name
+			sources = append(sources, &source{name: t.Name + "_" + name, tier: tierFast, url: t.CollectorURLs[name],
+				fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+					fetchXmsV2Collector(fc, t, name, wg)
+				}})
+		}
+	}
+	return
+}
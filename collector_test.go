@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func Test_writeMetricSets(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var logs bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	state := metrics.NewSet()
+	setMetricValue(state, `sipproxyd_up{dc="Wien"}`, 1)
+	setMetricValue(state, `sipproxyd_state{dc="Wien"}`, 1)
+	trunks := metrics.NewSet()
+	setMetricValue(trunks, `sipproxyd_up{dc="Wien"}`, 0)
+	setMetricValue(trunks, `sipproxyd_bt_active_calls_current{dc="Wien"}`, 7)
+	setMetricValue(trunks, `sipproxyd_state{dc="Wien"}`, 1)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{state, trunks})
+	want := `sipproxyd_bt_active_calls_current{dc="Wien"} 7
+sipproxyd_state{dc="Wien"} 1
+sipproxyd_up{dc="Wien"} 1
+`
+	if buf.String() != want {
+		t.Errorf("writeMetricSets() = %q, want %q", buf.String(), want)
+	}
+	if got := strings.Count(logs.String(), "conflicting"); got != 1 {
+		t.Errorf("writeMetricSets() logged %d conflicts, want 1 for sipproxyd_up:\n%s", got, logs.String())
+	}
+}
+
+func Test_writeMetricSetsHelp(t *testing.T) {
+	set := metrics.NewSet()
+	setMetricValue(set, `xms_counter_sent_sip_invites`, 3)
+	setMetricValue(set, `xms_counter_sent{type="sip"}`, 1)
+	setMetricValue(set, `xms_counter_sent`, 2)
+	setMetricHelp("xms_counter_sent", `Sent \ "all"`)
+	setMetricHelp("xms_counter_sent_sip_invites", "Sent SIP Invites")
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{set})
+	want := `# HELP xms_counter_sent Sent \\ "all"
+xms_counter_sent 2
+xms_counter_sent{type="sip"} 1
+# HELP xms_counter_sent_sip_invites Sent SIP Invites
+xms_counter_sent_sip_invites 3
+`
+	if buf.String() != want {
+		t.Errorf("writeMetricSets() = %q, want %q", buf.String(), want)
+	}
+}
+
+func Test_sourceRefresh(t *testing.T) {
+	fetches := 0
+	s := &source{name: "test", tier: tierSlow, fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+		defer wg.Done()
+		fetches++
+		setMetricValue(fc.set, "test_fetches", uint64(fetches))
+	}}
+	s.refresh(time.Minute)
+	s.refresh(time.Minute)
+	if fetches != 1 {
+		t.Errorf("source.refresh() fetched %d times within interval, want 1", fetches)
+	}
+	s.refresh(0)
+	if fetches != 2 {
+		t.Errorf("source.refresh() fetched %d times without interval, want 2", fetches)
+	}
+}
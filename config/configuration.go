@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // AppConfig allows global access to config
 var AppConfig = &AppConfiguration{}
 
@@ -7,17 +9,44 @@ var AppConfig = &AppConfiguration{}
 type AppConfiguration struct {
 	Debug         bool
 	ListenAddress string `default:":9055"`
+	WebConfigFile string // TLS and basic authentication of the listener, see web-config.yml.example
+	DrainTimeout  time.Duration `default:"10s"` // Maximum time to finish in-flight requests on shutdown
+	Timezone      string // Timezone of the C5 timestamps, e.g. "Europe/Vienna", defaults to local time
+	NodeID        string // C5 node id of this host, used to detect the cluster master
+
+	// Logging
+	LogLevel          string        `default:"info"` // debug, info, warn or error
+	LogFormat         string        `default:"text"` // text or json
+	LogRepeatInterval time.Duration `default:"5m"`   // Minimum interval between repeated connection errors of a source, 0 logs all
 
 	// XMS Configuration
 	XmsEnabled     bool
 	XmsV2Enabled   bool
 	XmsUser        string `default:"admin"`
-	XmsPwd         string `default:"admin"`
+	XmsPwd         Secret `default:"admin"`
+	XmsPwdFile     string // File containing the password, overrides xmsPwd
+	XmsPwdEnv      string // Environment variable containing the password, overrides xmsPwd and xmsPwdFile
 	XmsCountersURL string `default:"http://localhost:10080/resource/counters"`
 	XmsLicensesURL string `default:"http://localhost:10080/resource/licenses"`
 	Xmsv2LicensesURL string `default:"http://localhost:10080/v2/license/stats"`
 	Xmsv2CountersURL string `default:"http://localhost:10080/v2/sessions"`
 
+	// Optional XMS v2 sub-collectors: system, calls, conferences, network, streams
+	XmsV2Collectors     []string
+	Xmsv2SystemURL      string `default:"http://localhost:10080/v2/system"`
+	Xmsv2CallsURL       string `default:"http://localhost:10080/v2/calls"`
+	Xmsv2ConferencesURL string `default:"http://localhost:10080/v2/conferences"`
+	Xmsv2NetworkURL     string `default:"http://localhost:10080/v2/network"`
+	Xmsv2StreamsURL     string `default:"http://localhost:10080/v2/streams"`
+
+	// Additional XMS media servers
+	XmsTargets []XmsTarget `toml:"xms"`
+
+	// TLS settings of the XMS and C5 endpoints using HTTPS, used unless
+	// configured per [[xms]] or [[daemon]]
+	XmsTLS TLSConfig
+	C5TLS  TLSConfig
+
 	// C5 Configuration
 	SIPProxydEnabled        bool
 	SIPProxydExtEnabled     bool
@@ -25,6 +54,8 @@ type AppConfiguration struct {
 	SIPProxydTrunksEnabled  bool
 	SIPProxydTrunkStatsURL  string `default:"http://127.0.0.1:9980/c5/proxy/commands?3&7&309"`
 	SIPProxydTrunkLimitsURL string `default:"http://127.0.0.1:9980/c5/proxy/commands?3&7&368"`
+	SIPProxydTrunkCallLimitsURL string            // Sessionconsole command listing the call limit of each trunk
+	SIPProxydTrunkCallLimits    map[string]uint64 // Call limit by trunk name, overriding the limits of SIPProxydTrunkCallLimitsURL
 	SIPProxydSPCountersURL  string `default:"http://127.0.0.1:9980/c5/proxy/commands?4&0&spAll"`
 	SIPProxydClSPCountersURL string `default:"http://127.0.0.1:9980/c5/proxy/commands?4&0&spAllCl"`
 	ACDQueuedEnabled        bool
@@ -39,7 +70,103 @@ type AppConfiguration struct {
 	ACDQueuedBaseURL		string `default:"http://127.0.0.1:9982/c5/proxy/commands"`
 	RegistrardBaseURL		string `default:"http://127.0.0.1:9984/c5/proxy/commands"`
 	NotificationBaseURL		string `default:"http://127.0.0.1:9988/c5/proxy/commands"`
+	CstaBaseURL				string `default:"http://127.0.0.1:9986/c5/proxy/commands"`
+
+	// Additional C5 daemons, replacing the built-in daemon with the same prefix
+	Daemons []DaemonConfig `toml:"daemon"`
+
+	// Additional C5 counter table queries
+	CounterQueries []CounterQuery `toml:"counterQuery"`
+
+	// Collection tiers
+	FastTierInterval     time.Duration     // Minimum refresh interval of the fast tier, 0 refreshes on each scrape
+	SlowTierInterval     time.Duration     `default:"5m"` // Minimum refresh interval of the slow tier
+	MetricsTiers         []string          `default:"[fast]"` // Tiers served by /metrics
+	MetricsExtendedTiers []string          `default:"[slow]"` // Tiers served by /metrics-extended
+	SourceTiers          map[string]string // Tier by source name overriding the default tier
+
+	// Hazelcast map statistics
+	HazelcastMapListTTL  time.Duration `default:"5m"` // Maximum age of the cached map list, 0 fetches it on each scrape
+	HazelcastWorkers     int           `default:"4"`  // Map details fetched in parallel per daemon
+	HazelcastTimeout     time.Duration `default:"5s"` // Deadline for fetching all maps of a daemon
+	CstaHazelcastEnabled bool          // Query hazelcast map statistics of the built-in cstagwd
+
+	// Duration without change of the memory update counter until a daemon is reported
+	// by <prefix>_memory_stale, 0 disables the detection
+	MemoryStaleAfter time.Duration `default:"5m"`
+
+	// Duration without change of the TU queue checked count until a daemon is reported
+	// by <prefix>_tu_queue_stuck, 0 disables the detection
+	TuQueueStuckAfter time.Duration `default:"15m"`
 
 	// Misc
 	GoCollectorEnabled      bool
+	ProcessMetricsEnabled   bool
+
+	// Serve /debug/sources/<name> with the last responses of each source, requires
+	// basic authentication in the web config file
+	DebugSourcesEnabled bool
+}
+
+// TLSConfig defines the TLS settings of an HTTPS endpoint
+type TLSConfig struct {
+	CAFile             string // CA certificates to verify the server certificate, defaults to the system CAs
+	CertFile           string // Client certificate
+	KeyFile            string // Client key
+	ServerName         string // Server name to verify the certificate, defaults to the host of the URL
+	InsecureSkipVerify bool   // Disable verification of the server certificate
+}
+
+// XmsTarget defines a Dialogic XMS media server, its series are labelled by name
+type XmsTarget struct {
+	Name        string // Name used for the xms label, e.g. "media1"
+	Version     string // REST API version "v1" or "v2" (XMS 5.2 or newer), defaults to "v1"
+	BaseURL     string // Base URL, e.g. "http://media1:10080"
+	CountersURL string // Counters URL, defaults to <BaseURL>/resource/counters (v1) or <BaseURL>/v2/sessions (v2)
+	LicensesURL string // Licenses URL, defaults to <BaseURL>/resource/licenses (v1) or <BaseURL>/v2/license/stats (v2)
+	User        string // User, defaults to the global xmsUser
+	Pwd         Secret // Password, defaults to the global xmsPwd
+	PwdFile     string // File containing the password, overrides pwd
+	PwdEnv      string // Environment variable containing the password, overrides pwd and pwdFile
+
+	// Optional v2 sub-collectors: system, calls, conferences, network, streams
+	Collectors    []string
+	CollectorURLs map[string]string // URL by sub-collector, defaults to <BaseURL>/v2/<collector>
+
+	TLS TLSConfig // Defaults to the global xmsTLS
+}
+
+// CounterQuery defines an additional per-counter table query of a C5 daemon
+type CounterQuery struct {
+	Daemon    string // Prefix of the daemon to query, e.g. "sipproxyd"
+	CounterID uint   // C5 counter id, e.g. 309 for BT_ACTIVE_CALLS
+	Label     string // Label name used for the table rows, defaults to "name"
+	Table     string // Metric name segment of the table rows, defaults to "table"
+}
+
+// DaemonConfig defines a C5 daemon providing the sessionconsole JSON format
+type DaemonConfig struct {
+	Name      string // Name of the daemon, e.g. "sipproxyd"
+	Prefix    string // Metric prefix, defaults to the name
+	StateURL  string // State URL, defaults to "<BaseURL>?49&1&-v"
+	BaseURL   string // Base command URL, e.g. "http://127.0.0.1:9980/c5/proxy/commands"
+	Hazelcast bool   // Query hazelcast map statistics using the base URL
+	NodeID    string // C5 node id of the daemon, defaults to the global node id
+
+	// Hazelcast map selection using shell patterns like "session*"
+	HazelcastInclude []string // Maps to query, all maps if empty
+	HazelcastExclude []string // Maps to skip even if included
+
+	// Sessionconsole command listing the hazelcast cluster members, e.g. "95&1",
+	// the members are not queried if empty
+	HazelcastMembersCommand string
+
+	TLS TLSConfig // Defaults to the global c5TLS
+
+	// Process metrics
+	ProcessName string // Process name, defaults to the name
+	PidFile     string // Pid file used instead of searching the process name
+
+	// Quirks
+	IgnoreIncompleteSubEvents bool // Ignore event sub counters without index lines (cstagwd CASS_ERR)
 }
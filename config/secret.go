@@ -0,0 +1,20 @@
+package config
+
+// Secret is a string like a password which is redacted when printed, e.g. in the
+// logged configuration
+type Secret string
+
+const redacted = "<secret>"
+
+// String returns the redacted secret, empty secrets are shown as empty
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString returns the redacted secret for the %#v format
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+var labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// counterQuery is a resolved per-counter table query of a C5 daemon
+type counterQuery struct {
+	prefix string
+	id     uint
+	table  string
+	label  string
+	url    string
+	tls    config.TLSConfig
+}
+
+// buildCounterQueries resolves the configured counter queries to the command URL
+// of the daemon, e.g. "http://127.0.0.1:9980/c5/proxy/commands?3&7&309"
+func buildCounterQueries(conf *config.AppConfiguration, daemons []config.DaemonConfig) (queries []counterQuery) {
+	byPrefix := make(map[string]config.DaemonConfig)
+	for _, d := range daemons {
+		byPrefix[d.Prefix] = d
+	}
+	for _, q := range conf.CounterQueries {
+		daemon, ok := byPrefix[q.Daemon]
+		baseURL := daemon.BaseURL
+		if !ok || baseURL == "" {
+			logError("Ignoring counter query", q.CounterID, "for unknown daemon or daemon without baseURL", q.Daemon)
+			continue
+		}
+		label := q.Label
+		if label == "" {
+			label = "name"
+		}
+		if !labelNameRegex.MatchString(label) {
+			logError("Ignoring counter query", q.CounterID, "for", q.Daemon, "with invalid label", label)
+			continue
+		}
+		table := q.Table
+		if table == "" {
+			table = "table"
+		}
+		if !labelNameRegex.MatchString(table) {
+			logError("Ignoring counter query", q.CounterID, "for", q.Daemon, "with invalid table", table)
+			continue
+		}
+		url := fmt.Sprintf("%s?3&7&%d", baseURL, q.CounterID)
+		logInfo("counter query", q.CounterID, "enabled for", q.Daemon, "with url", url)
+		queries = append(queries, counterQuery{q.Daemon, q.CounterID, table, label, url, daemon.TLS})
+	}
+	return
+}
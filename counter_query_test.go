@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_buildCounterQueries(t *testing.T) {
+	conf := &config.AppConfiguration{CounterQueries: []config.CounterQuery{
+		{Daemon: "sipproxyd", CounterID: 309},
+		{Daemon: "sipproxyd", CounterID: 45, Table: "user", Label: "user"},
+		{Daemon: "sipproxyd", CounterID: 46, Table: "user-table"},
+		{Daemon: "unknownd", CounterID: 47},
+	}}
+	daemons := []config.DaemonConfig{{Name: "sipproxyd", Prefix: "sipproxyd", BaseURL: "http://127.0.0.1:9980/c5/proxy/commands"}}
+
+	got := buildCounterQueries(conf, daemons)
+	if len(got) != 2 {
+		t.Fatalf("buildCounterQueries() = %+v, want 2 queries", got)
+	}
+	if q := got[0]; q.table != "table" || q.label != "name" || q.url != "http://127.0.0.1:9980/c5/proxy/commands?3&7&309" {
+		t.Errorf("buildCounterQueries() defaults = %+v", q)
+	}
+	if q := got[1]; q.table != "user" || q.label != "user" {
+		t.Errorf("buildCounterQueries() table and label = %q, %q, want user, user", q.table, q.label)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// legacyDaemons returns the built-in C5 daemons enabled by the
+// <daemon>Enabled configuration flags
+func legacyDaemons(conf *config.AppConfiguration) (daemons []config.DaemonConfig) {
+	if conf.SIPProxydEnabled {
+		daemons = append(daemons, config.DaemonConfig{Name: "sipproxyd", Prefix: "sipproxyd",
+			StateURL: conf.SIPProxydURL, BaseURL: conf.SIPProxydBaseURL, Hazelcast: true})
+	}
+	if conf.ACDQueuedEnabled {
+		daemons = append(daemons, config.DaemonConfig{Name: "acdqueued", Prefix: "acdqueued",
+			StateURL: conf.ACDQueuedURL, BaseURL: conf.ACDQueuedBaseURL, Hazelcast: true})
+	}
+	if conf.RegistrardEnabled {
+		daemons = append(daemons, config.DaemonConfig{Name: "registrard", Prefix: "registrard",
+			StateURL: conf.RegistrardURL, BaseURL: conf.RegistrardBaseURL, Hazelcast: true})
+	}
+	if conf.NotificationEnabled {
+		daemons = append(daemons, config.DaemonConfig{Name: "notification-server", Prefix: "notification",
+			StateURL: conf.NotificationURL, BaseURL: conf.NotificationBaseURL, Hazelcast: true})
+	}
+	if conf.CstaEnabled {
+		// see https://github.com/communi5/prometheus-c5-exporter/issues/1
+		daemons = append(daemons, config.DaemonConfig{Name: "cstagwd", Prefix: "cstagwd",
+			StateURL: conf.CstaURL, BaseURL: conf.CstaBaseURL, Hazelcast: conf.CstaHazelcastEnabled,
+			IgnoreIncompleteSubEvents: true})
+	}
+	return
+}
+
+// buildDaemons returns the built-in daemons merged with the [[daemon]] entries of
+// the configuration. A configured daemon replaces a built-in daemon with the same prefix.
+func buildDaemons(conf *config.AppConfiguration) (daemons []config.DaemonConfig) {
+	daemons = legacyDaemons(conf)
+	for _, d := range conf.Daemons {
+		if d.Prefix == "" {
+			d.Prefix = d.Name
+		}
+		if d.StateURL == "" && d.BaseURL != "" {
+			d.StateURL = d.BaseURL + "?49&1&-v"
+		}
+		if !metricNameRegex.MatchString(d.Prefix) {
+			logError("Ignoring daemon", d.Name, "with invalid prefix", d.Prefix)
+			continue
+		}
+		if d.StateURL == "" {
+			logError("Ignoring daemon", d.Name, "without stateURL or baseURL")
+			continue
+		}
+		if d.Hazelcast && d.BaseURL == "" {
+			logError("Disabling hazelcast for daemon", d.Name, "without baseURL")
+			d.Hazelcast = false
+		}
+		for _, pattern := range append(append([]string{}, d.HazelcastInclude...), d.HazelcastExclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				logError("Invalid hazelcast map pattern", pattern, "for daemon", d.Name)
+			}
+		}
+		replaced := false
+		for i := range daemons {
+			if daemons[i].Prefix == d.Prefix {
+				daemons[i] = d
+				replaced = true
+			}
+		}
+		if !replaced {
+			daemons = append(daemons, d)
+		}
+	}
+	for i := range daemons {
+		if daemons[i].NodeID == "" {
+			daemons[i].NodeID = conf.NodeID
+		}
+		if daemons[i].TLS == (config.TLSConfig{}) {
+			daemons[i].TLS = conf.C5TLS
+		}
+	}
+	for _, d := range daemons {
+		logInfo(d.Name, "enabled with prefix", d.Prefix, "and url", d.StateURL)
+		if d.Hazelcast {
+			logDebug(d.Name, "hazelcast enabled with url", d.BaseURL)
+		}
+		checkTLSConfig(d.Name, d.TLS)
+	}
+	return
+}
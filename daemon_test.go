@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_buildDaemons(t *testing.T) {
+	conf := &config.AppConfiguration{
+		SIPProxydEnabled: true,
+		SIPProxydURL:     "http://127.0.0.1:9980/c5/proxy/commands?49&1&-v",
+		CstaEnabled:      true,
+		Daemons: []config.DaemonConfig{
+			{Name: "cstagwd", BaseURL: "http://127.0.0.1:9986/c5/proxy/commands", Hazelcast: true},
+			{Name: "mydaemond", BaseURL: "http://127.0.0.1:9990/c5/proxy/commands"},
+			{Name: "invalid-name"},
+		},
+	}
+	daemons := buildDaemons(conf)
+	if len(daemons) != 3 {
+		t.Fatalf("buildDaemons() got %d daemons, want 3: %+v", len(daemons), daemons)
+	}
+	if d := daemons[1]; d.Prefix != "cstagwd" || !d.Hazelcast || d.IgnoreIncompleteSubEvents {
+		t.Errorf("buildDaemons() did not replace built-in cstagwd: %+v", d)
+	}
+	if d := daemons[2]; d.Prefix != "mydaemond" || d.StateURL != "http://127.0.0.1:9990/c5/proxy/commands?49&1&-v" {
+		t.Errorf("buildDaemons() got unexpected defaults: %+v", d)
+	}
+}
+
+func Test_legacyDaemonsCstaHazelcast(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		daemons := legacyDaemons(&config.AppConfiguration{CstaEnabled: true, CstaHazelcastEnabled: enabled})
+		if len(daemons) != 1 || daemons[0].Hazelcast != enabled || !daemons[0].IgnoreIncompleteSubEvents {
+			t.Errorf("legacyDaemons() with cstaHazelcastEnabled=%v got %+v", enabled, daemons)
+		}
+	}
+}
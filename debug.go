@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Maximum size of a response body kept for the debug page
+const maxDebugBodySize = 1 << 20
+
+// Classification of the lines of a C5 response shown on the debug page
+const (
+	debugEvent     = "event"
+	debugUsage     = "usage"
+	debugSubEvent  = "sub event"
+	debugSubUsage  = "sub usage"
+	debugBreakdown = "breakdown"
+	debugTable     = "table"
+	debugIgnored   = "ignored"
+)
+
+type debugResponse struct {
+	URL  string
+	Body bytes.Buffer
+}
+
+type debugLine struct {
+	Kind   string
+	Line   string
+	Reason string // Reason why the line was ignored
+}
+
+// sourceDebug records the responses and parsed lines of the last refresh of a source
+type sourceDebug struct {
+	mtx       sync.Mutex
+	responses []*debugResponse
+	lines     []debugLine
+}
+
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		chunk := p
+		if len(chunk) > l.n {
+			chunk = chunk[:l.n]
+		}
+		l.n -= len(chunk)
+		l.w.Write(chunk)
+	}
+	return len(p), nil
+}
+
+// debugBody returns the body of a response of url, copying it to the debug record
+// of the fetch if debugSourcesEnabled is configured
+func debugBody(fc *fetchContext, url string, body io.Reader) io.Reader {
+	d := fc.debug
+	if d == nil {
+		return body
+	}
+	r := &debugResponse{URL: url}
+	d.mtx.Lock()
+	d.responses = append(d.responses, r)
+	d.mtx.Unlock()
+	return io.TeeReader(body, &limitedWriter{&r.Body, maxDebugBodySize})
+}
+
+// debugParsedLine records how a line of a response was interpreted
+func debugParsedLine(fc *fetchContext, kind, line, reason string) {
+	d := fc.debug
+	if d == nil {
+		return
+	}
+	d.mtx.Lock()
+	d.lines = append(d.lines, debugLine{kind, line, reason})
+	d.mtx.Unlock()
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>C5 Exporter - {{.Name}}</title></head>
+<body>
+<h1>Source {{.Name}}</h1>
+<p><a href="../../">Back</a></p>
+{{- if not .Recorded}}
+<p>Not scraped since startup</p>
+{{- end}}
+{{- with .Status.Errors}}
+<h2>Errors</h2>
+<ul>
+{{- range .}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range .Responses}}
+<h2>Response of {{.URL}}</h2>
+<pre>{{.Body.String}}</pre>
+{{- end}}
+{{- with .Lines}}
+<h2>Parsed lines</h2>
+<table border="1" cellpadding="4">
+<tr><th>Type</th><th>Line</th><th>Reason</th></tr>
+{{- range .}}
+<tr><td>{{.Kind}}</td><td><pre>{{.Line}}</pre></td><td>{{.Reason}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Series</h2>
+<pre>{{.Series}}</pre>
+</body>
+</html>
+`))
+
+// debugHandler serves /debug/sources/<name> showing the last responses of a source,
+// how their lines were parsed and the resulting series. The page contains the raw
+// responses and is therefore only served to authenticated users.
+func (c *collector) debugHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := authenticatedUser(req); !ok {
+		http.Error(w, "Debug pages require basic_auth_users in the web config file", http.StatusForbidden)
+		return
+	}
+	name := strings.TrimPrefix(req.URL.Path, "/debug/sources/")
+	var s *source
+	for _, src := range c.sources {
+		if src.name == name {
+			s = src
+		}
+	}
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	status, d := s.lastStatus(), s.lastDebug()
+	var series bytes.Buffer
+	if set := s.metricSet(); set != nil {
+		writeMetricSets(&series, []*metrics.Set{set})
+	}
+	data := struct {
+		Name      string
+		Recorded  bool
+		Status    sourceStatus
+		Responses []*debugResponse
+		Lines     []debugLine
+		Series    string
+	}{Name: s.name, Recorded: d != nil, Status: status, Series: series.String()}
+	if d != nil {
+		data.Responses, data.Lines = d.responses, d.lines
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debugTemplate.Execute(w, data); err != nil {
+		logError("Failed to render debug page of", s.name, err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_processC5StateCounterDebug(t *testing.T) {
+	fc := testFetchContext()
+	fc.debug = &sourceDebug{}
+	lines := []interface{}{
+		"       Event counters                              absolute   curr   last",
+		"  0 TRANSPORT_MESSAGE_IN                              6461     31     69",
+		[]interface{}{"425 CASS_ERR_CONN_TMO                                  0      0      0"},
+		"       Usage counters                              current    min    max   lMin   lMax   lAvg",
+		" 75 PRESENCE_ACTIVE_SUBSCRIPTIONS                       36     36     36     36     36     36       2045",
+		"    OBSERVERS  (dialog,csta,reg):  36,0,0",
+		"    unknown",
+	}
+	daemon := config.DaemonConfig{Prefix: "cstagwd", IgnoreIncompleteSubEvents: true}
+	processC5StateCounter(fc, daemon, lines, nil)
+
+	d := fc.debug
+	want := []string{debugIgnored, debugEvent, debugIgnored, debugIgnored, debugUsage, debugBreakdown, debugIgnored}
+	if len(d.lines) != len(want) {
+		t.Fatalf("recorded %d lines, want %d: %+v", len(d.lines), len(want), d.lines)
+	}
+	for i, l := range d.lines {
+		if l.Kind != want[i] {
+			t.Errorf("line %d %q recorded as %s, want %s", i, l.Line, l.Kind, want[i])
+		}
+		if l.Kind == debugIgnored && l.Reason == "" {
+			t.Errorf("line %d %q ignored without reason", i, l.Line)
+		}
+	}
+}
+
+func Test_debugHandler(t *testing.T) {
+	config.AppConfig.DebugSourcesEnabled = true
+	defer func() { config.AppConfig.DebugSourcesEnabled = false }()
+
+	s := &source{name: "sipproxyd", tier: tierFast, fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+		defer wg.Done()
+		io.ReadAll(debugBody(fc, "http://c5/commands", strings.NewReader(`{"counterInfos": ["<raw>"]}`)))
+		setMetricValue(fc.set, "sipproxyd_up", 1)
+	}}
+	c := testCollector(s)
+	c.collect([]string{tierFast})
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &basicAuth{users: map[string]config.Secret{"admin": config.Secret(hash)},
+		handler: http.HandlerFunc(c.debugHandler)}
+
+	tests := []struct {
+		name       string
+		path       string
+		auth       bool
+		wantStatus int
+		wantBody   []string
+	}{
+		{"source", "/debug/sources/sipproxyd", true, http.StatusOK,
+			[]string{"http://c5/commands", "&#34;counterInfos&#34;: [&#34;&lt;raw&gt;&#34;]", "sipproxyd_up 1"}},
+		{"unknown source", "/debug/sources/unknown", true, http.StatusNotFound, nil},
+		{"without authentication", "/debug/sources/sipproxyd", false, http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rec := httptest.NewRecorder()
+			if tt.auth {
+				req.SetBasicAuth("admin", "secret")
+				auth.ServeHTTP(rec, req)
+			} else {
+				c.debugHandler(rec, req)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("debugHandler() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("debugHandler() body does not contain %q", want)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 module github.com/communi5/prometheus-c5-exporter
 
-go 1.19
+go 1.21
 
 require (
 	github.com/VictoriaMetrics/metrics v1.33.1
 	github.com/jinzhu/configor v1.2.2
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -12,5 +14,4 @@ require (
 	github.com/valyala/fastrand v1.1.0 // indirect
 	github.com/valyala/histogram v1.2.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+type c5MapListResponse struct {
+	ProxyResponseTimeStampAndState string   `json:"proxyResponseTimeStampAndState:"`
+	Maps                           []string `json:"maps"`
+}
+
+// c5HazelcastMembersResponse is the response of the configured members command
+//
+//	{
+//	  "clusterState" : "ACTIVE",
+//	  "members" : [
+//	    "Member [10.0.0.1]:5701 this",
+//	    "Member [10.0.0.2]:5701"
+//	  ]
+//	}
+type c5HazelcastMembersResponse struct {
+	ProxyResponseTimeStampAndState string   `json:"proxyResponseTimeStampAndState:"`
+	ClusterState                   string   `json:"clusterState"`
+	Members                        []string `json:"members"`
+}
+
+// c5MapDetail holds the numeric fields of a map detail response by metric name
+//
+//	{
+//	  "cache_name" : "sessionMap",
+//	  "cache_size_entries" : 10,
+//	  "cache_size_bytes" : 2048,
+//	  "cache_hits" : 5,
+//	  "cache_misses" : 1,
+//	  "cache_hit_ratio_percent" : 83.3,
+//	  "owned_entries" : 7
+//	}
+type c5MapDetail struct {
+	Name   string
+	Values map[string]float64
+}
+
+// Fields of the map detail response counting events since the daemon start,
+// exported with the _total suffix
+var hazelcastCounterSuffixes = []string{"hits", "misses", "evictions", "expirations"}
+
+// parseMapDetail decodes all numeric fields of a map detail response. The metric
+// name of a field is prefixed with cache_ unless it already is.
+func parseMapDetail(r io.Reader) (detail c5MapDetail, err error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err = dec.Decode(&fields); err != nil {
+		return
+	}
+	detail.Values = make(map[string]float64)
+	for key, value := range fields {
+		if key == "cache_name" {
+			detail.Name, _ = value.(string)
+			continue
+		}
+		num, isNumber := value.(json.Number)
+		if !isNumber {
+			continue
+		}
+		f, err := num.Float64()
+		if err != nil {
+			continue
+		}
+		name := sanitizeMetricName(key)
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, "cache_") {
+			name = "cache_" + name
+		}
+		for _, suffix := range hazelcastCounterSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				name += "_total"
+				break
+			}
+		}
+		detail.Values[name] = f
+	}
+	return
+}
+
+// selectHazelcastMaps returns the maps matching any include pattern (all maps
+// if there are none) and no exclude pattern
+func selectHazelcastMaps(maps, include, exclude []string) (selected []string) {
+	matchAny := func(patterns []string, name string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range maps {
+		if len(include) > 0 && !matchAny(include, name) {
+			continue
+		}
+		if matchAny(exclude, name) {
+			continue
+		}
+		selected = append(selected, name)
+	}
+	return
+}
+
+// Hazelcast map names by base URL, cached to avoid fetching the list on each scrape
+type hazelcastMapList struct {
+	maps    []string
+	fetched time.Time
+}
+
+var gHazelcastMaps map[string]hazelcastMapList
+var hazelcastMtx sync.Mutex
+
+func getJSON(ctx context.Context, fc *fetchContext, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(debugBody(fc, url, resp.Body)).Decode(v)
+}
+
+func getMapDetail(ctx context.Context, fc *fetchContext, client *http.Client, url string) (c5MapDetail, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return c5MapDetail{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return c5MapDetail{}, err
+	}
+	defer resp.Body.Close()
+	return parseMapDetail(debugBody(fc, url, resp.Body))
+}
+
+// getHazelcastMaps returns the map names of the daemon, fetched again once
+// the cached list is older than ttl
+func getHazelcastMaps(ctx context.Context, fc *fetchContext, client *http.Client, baseURL string, ttl time.Duration) ([]string, error) {
+	hazelcastMtx.Lock()
+	cached, ok := gHazelcastMaps[baseURL]
+	hazelcastMtx.Unlock()
+	if ok && time.Since(cached.fetched) < ttl {
+		return cached.maps, nil
+	}
+
+	var listResp c5MapListResponse
+	if err := getJSON(ctx, fc, client, baseURL+"?95&0", &listResp); err != nil {
+		return nil, err
+	}
+
+	hazelcastMtx.Lock()
+	defer hazelcastMtx.Unlock()
+	if gHazelcastMaps == nil {
+		gHazelcastMaps = make(map[string]hazelcastMapList)
+	}
+	gHazelcastMaps[baseURL] = hazelcastMapList{listResp.Maps, time.Now()}
+	return listResp.Maps, nil
+}
+
+// processHazelcastMembers sets the number of cluster members and the cluster state,
+// the state is omitted if not reported by the daemon
+func processHazelcastMembers(set *metrics.Set, prefix string, members c5HazelcastMembersResponse, attrs []MetricAttribute) {
+	setMetricValue(set, buildMetricName(prefix, "hazelcast_cluster_members", attrs), uint64(len(members.Members)))
+	if members.ClusterState == "" {
+		return
+	}
+	tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"state", strings.ToLower(members.ClusterState)})
+	setMetricValue(set, buildMetricName(prefix, "hazelcast_cluster_state", tmp), 1)
+}
+
+// fetchC5HazelcastMembers fetches the hazelcast cluster members of a daemon
+func fetchC5HazelcastMembers(ctx context.Context, fc *fetchContext, client *http.Client, daemon config.DaemonConfig, attrs []MetricAttribute) {
+	set := fc.set
+	var members c5HazelcastMembersResponse
+	if err := getJSON(ctx, fc, client, daemon.BaseURL+"?"+daemon.HazelcastMembersCommand, &members); err != nil {
+		logSourceError(fc, "Failed to fetch hazelcast members", "prefix", daemon.Prefix, "err", err)
+		setMetricValue(set, buildMetricName(daemon.Prefix, "hazelcast_cluster_up", attrs), 0)
+		return
+	}
+	setMetricValue(set, buildMetricName(daemon.Prefix, "hazelcast_cluster_up", attrs), 1)
+	processHazelcastMembers(set, daemon.Prefix, members, attrs)
+}
+
+// fetchC5HazelcastMetrics fetches the statistics of all hazelcast maps of a daemon
+// using a bounded number of parallel requests. Once the deadline is reached the
+// maps fetched so far are reported and <prefix>_hazelcast_scrape_complete is 0.
+func fetchC5HazelcastMetrics(fc *fetchContext, daemon config.DaemonConfig, conf *config.AppConfiguration, wg *sync.WaitGroup) {
+	defer wg.Done()
+	set := fc.set
+	prefix := daemon.Prefix
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.HazelcastTimeout)
+	defer cancel()
+	attrsBase := getGlobalAttrs(prefix)
+
+	client, err := getHTTPClient(daemon.TLS, true)
+	if err != nil {
+		logSourceError(fc, "Failed to create hazelcast client", "prefix", prefix, "err", err)
+		setMetricValue(set, buildMetricName(prefix, "hazelcast_scrape_complete", attrsBase), 0)
+		return
+	}
+
+	if daemon.HazelcastMembersCommand != "" {
+		fetchC5HazelcastMembers(ctx, fc, client, daemon, attrsBase)
+	}
+
+	// 1) fetch list of maps
+	maps, err := getHazelcastMaps(ctx, fc, client, daemon.BaseURL, conf.HazelcastMapListTTL)
+	if err != nil {
+		logConnectError(fc, "Failed to fetch map list", "err", err)
+		setMetricValue(set, buildMetricName(prefix, "hazelcast_scrape_complete", attrsBase), 0)
+		return
+	}
+	maps = selectHazelcastMaps(maps, daemon.HazelcastInclude, daemon.HazelcastExclude)
+
+	// 2) fetch details for each map
+	var completed int64
+	jobs := make(chan string)
+	var workers sync.WaitGroup
+	for i := 0; i < conf.HazelcastWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for mapName := range jobs {
+				detail, err := getMapDetail(ctx, fc, client, daemon.BaseURL+"?92&31&"+url.QueryEscape(mapName))
+				if err != nil {
+					logSourceError(fc, "Failed to fetch map detail", "map", mapName, "err", err)
+					continue
+				}
+				if detail.Name == "" {
+					detail.Name = mapName
+				}
+
+				attrs := append(append([]MetricAttribute{}, attrsBase...), MetricAttribute{"map", escapeLabelValue(detail.Name)})
+				for name, value := range detail.Values {
+					setFloatMetricValue(set, buildMetricName(prefix+"_hazelcast", name, attrs), value)
+				}
+				atomic.AddInt64(&completed, 1)
+			}
+		}()
+	}
+feed:
+	for _, mapName := range maps {
+		select {
+		case jobs <- mapName:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	workers.Wait()
+
+	var complete uint64
+	if int(completed) == len(maps) {
+		complete = 1
+	} else {
+		logSourceError(fc, "Incomplete hazelcast scrape", "prefix", prefix, "completed", completed, "maps", len(maps))
+	}
+	setMetricValue(set, buildMetricName(prefix, "hazelcast_scrape_complete", attrsBase), complete)
+}
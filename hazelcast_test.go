@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func TestGetHazelcastMaps(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"maps": ["mapA", "mapB"]}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		requests int
+	}{
+		{"initial fetch", time.Minute, 1},
+		{"cached", time.Minute, 1},
+		{"cache disabled", 0, 2},
+	}
+	want := []string{"mapA", "mapB"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maps, err := getHazelcastMaps(context.Background(), testFetchContext(), srv.Client(), srv.URL, tt.ttl)
+			if err != nil {
+				t.Fatalf("getHazelcastMaps() error = %v", err)
+			}
+			if !reflect.DeepEqual(maps, want) {
+				t.Errorf("getHazelcastMaps() = %v, want %v", maps, want)
+			}
+			if requests != tt.requests {
+				t.Errorf("getHazelcastMaps() requests = %d, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestParseMapDetail(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want c5MapDetail
+	}{
+		{"default fields", `{"proxyResponseTimeStampAndState:": "2024-01-01 10:00:00", "cache_name": "sessionMap",
+			"cache_size_entries": 10, "cache_size_bytes": 2048, "cache_hits": 5, "cache_misses": 1, "cache_hit_ratio_percent": 83.3}`,
+			c5MapDetail{"sessionMap", map[string]float64{"cache_size_entries": 10, "cache_size_bytes": 2048,
+				"cache_hits_total": 5, "cache_misses_total": 1, "cache_hit_ratio_percent": 83.3}}},
+		{"additional fields", `{"cache_name": "m", "owned_entries": 7, "backupEntries": 3, "cache_evictions": 2, "last_access": 1700000000000, "state": "ok"}`,
+			c5MapDetail{"m", map[string]float64{"cache_owned_entries": 7, "cache_backupentries": 3,
+				"cache_evictions_total": 2, "cache_last_access": 1700000000000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMapDetail(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("parseMapDetail() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMapDetail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectHazelcastMaps(t *testing.T) {
+	maps := []string{"sessionMap", "sessionBackup", "userMap"}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{"all", nil, nil, maps},
+		{"include", []string{"session*"}, nil, []string{"sessionMap", "sessionBackup"}},
+		{"exclude", nil, []string{"*Backup"}, []string{"sessionMap", "userMap"}},
+		{"include and exclude", []string{"session*"}, []string{"*Backup"}, []string{"sessionMap"}},
+		{"none", []string{"unknown"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectHazelcastMaps(maps, tt.include, tt.exclude); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectHazelcastMaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessHazelcastMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		members c5HazelcastMembersResponse
+		want    string
+	}{
+		{"members and state", c5HazelcastMembersResponse{ClusterState: "ACTIVE", Members: []string{"Member [10.0.0.1]:5701 this", "Member [10.0.0.2]:5701"}},
+			"sipproxyd_hazelcast_cluster_members 2\nsipproxyd_hazelcast_cluster_state{state=\"active\"} 1\n"},
+		{"members only", c5HazelcastMembersResponse{Members: []string{"Member [10.0.0.1]:5701 this"}},
+			"sipproxyd_hazelcast_cluster_members 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := metrics.NewSet()
+			processHazelcastMembers(set, "sipproxyd", tt.members, nil)
+			var buf bytes.Buffer
+			set.WritePrometheus(&buf)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("processHazelcastMembers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchC5HazelcastMetricsDebug(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RawQuery {
+		case "95&0":
+			w.Write([]byte(`{"maps": ["mapA"]}`))
+		case "95&1":
+			w.Write([]byte(`{"clusterState": "ACTIVE", "members": ["Member [10.0.0.1]:5701 this"]}`))
+		case "92&31&mapA":
+			w.Write([]byte(`{"cache_name": "mapA", "cache_size_entries": 10}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	fc := testFetchContext()
+	fc.debug = &sourceDebug{}
+	daemon := config.DaemonConfig{Prefix: "sipproxyd", BaseURL: srv.URL, HazelcastMembersCommand: "95&1"}
+	conf := &config.AppConfiguration{HazelcastWorkers: 1, HazelcastTimeout: time.Second}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	fetchC5HazelcastMetrics(fc, daemon, conf, &wg)
+
+	var urls []string
+	for _, r := range fc.debug.responses {
+		urls = append(urls, strings.TrimPrefix(r.URL, srv.URL))
+	}
+	want := []string{"?95&1", "?95&0", "?92&31&mapA"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("fetchC5HazelcastMetrics() recorded responses of %v, want %v", urls, want)
+	}
+	if len(fc.fetchErrors()) > 0 {
+		t.Errorf("fetchC5HazelcastMetrics() errors = %q", fc.fetchErrors())
+	}
+}
+
+func TestFetchC5HazelcastMetricsEscaping(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RawQuery {
+		case "95&0":
+			w.Write([]byte(`{"maps": ["map&\"x\""]}`))
+		case "92&31&map%26%22x%22":
+			w.Write([]byte(`{"cache_size_entries": 10}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	fc := testFetchContext()
+	daemon := config.DaemonConfig{Prefix: "sipproxyd", BaseURL: srv.URL}
+	conf := &config.AppConfiguration{HazelcastWorkers: 1, HazelcastTimeout: time.Second}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	fetchC5HazelcastMetrics(fc, daemon, conf, &wg)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{fc.set})
+	if want := `sipproxyd_hazelcast_cache_size_entries{map="map&\"x\""} 10`; !strings.Contains(buf.String(), want) {
+		t.Errorf("fetchC5HazelcastMetrics() output does not contain %s:\n%s", want, buf.String())
+	}
+	if len(fc.fetchErrors()) > 0 {
+		t.Errorf("fetchC5HazelcastMetrics() errors = %q", fc.fetchErrors())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+type httpClientKey struct {
+	tls        config.TLSConfig
+	keepAlives bool
+}
+
+// httpClient is a cached client with the modification time of its TLS files
+type httpClient struct {
+	client  *http.Client
+	modTime time.Time
+}
+
+// HTTP clients by TLS configuration, shared by all sources using the same settings
+var gHTTPClients map[httpClientKey]*httpClient
+var httpClientsMtx sync.Mutex
+
+// newTLSConfig creates the TLS configuration of a target. Certificates are verified
+// unless InsecureSkipVerify is explicitly enabled.
+func newTLSConfig(conf config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CAFile != "" {
+		ca, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// tlsFilesModTime returns the latest modification time of the CA, certificate and
+// key file of a TLS configuration, files which can not be read are ignored
+func tlsFilesModTime(conf config.TLSConfig) (modTime time.Time) {
+	for _, file := range []string{conf.CAFile, conf.CertFile, conf.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return
+}
+
+// getHTTPClient returns the client for the given TLS configuration, creating it
+// on first use and again once the TLS files changed, e.g. after a certificate
+// rotation. If the changed files are invalid the previous client is kept.
+// Keep-alives are disabled for servers closing idle connections early.
+func getHTTPClient(conf config.TLSConfig, keepAlives bool) (*http.Client, error) {
+	httpClientsMtx.Lock()
+	defer httpClientsMtx.Unlock()
+
+	key := httpClientKey{conf, keepAlives}
+	modTime := tlsFilesModTime(conf)
+	cached, ok := gHTTPClients[key]
+	if ok && cached.modTime.Equal(modTime) {
+		return cached.client, nil
+	}
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		// Warn once and retry on the next change, files may be rotated one by one
+		logWarn("Keeping previous TLS configuration, failed to reload changed TLS files:", err)
+		cached.modTime = modTime
+		return cached.client, nil
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+	tr.DisableKeepAlives = !keepAlives
+	client := &http.Client{Timeout: 2 * time.Second, Transport: tr}
+
+	if ok {
+		logInfo("Reloaded changed TLS files of", conf.CAFile, conf.CertFile, conf.KeyFile)
+		cached.client.CloseIdleConnections()
+	}
+	if gHTTPClients == nil {
+		gHTTPClients = make(map[httpClientKey]*httpClient)
+	}
+	gHTTPClients[key] = &httpClient{client, modTime}
+	return client, nil
+}
+
+// httpGet requests the url using the client of the given TLS configuration
+func httpGet(conf config.TLSConfig, url string) (*http.Response, error) {
+	client, err := getHTTPClient(conf, true)
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(url)
+}
+
+// checkTLSConfig logs an error if the TLS configuration of a target is invalid and
+// warns about disabled certificate verification
+func checkTLSConfig(target string, conf config.TLSConfig) {
+	if _, err := newTLSConfig(conf); err != nil {
+		logError("Invalid TLS configuration of", target, ":", err)
+	}
+	if conf.InsecureSkipVerify {
+		logInfo("Certificate verification of", target, "disabled by insecureSkipVerify")
+	}
+}
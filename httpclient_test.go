@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_httpGetTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     config.TLSConfig
+		wantErr bool
+	}{
+		{"verified by default", config.TLSConfig{}, true},
+		{"ca file", config.TLSConfig{CAFile: caFile}, false},
+		{"server name", config.TLSConfig{CAFile: caFile, ServerName: "example.com"}, false},
+		{"wrong server name", config.TLSConfig{CAFile: caFile, ServerName: "xms.invalid"}, true},
+		{"insecure", config.TLSConfig{InsecureSkipVerify: true}, false},
+		{"missing ca file", config.TLSConfig{CAFile: caFile + ".missing"}, true},
+		{"missing client cert", config.TLSConfig{CertFile: "client.pem", KeyFile: "client.key"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := httpGet(tt.tls, srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("httpGet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_httpGetTLSReload(t *testing.T) {
+	srv1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv1.Close()
+	// Second server with its own certificate for localhost
+	certFile, keyFile := writeTestCertificate(t)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv2 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv2.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv2.StartTLS()
+	defer srv2.Close()
+	srv2URL := strings.Replace(srv2.URL, "127.0.0.1", "localhost", 1)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCA := func(data []byte, modTime time.Time) {
+		if err := os.WriteFile(caFile, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(caFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(url string) error {
+		resp, err := httpGet(config.TLSConfig{CAFile: caFile}, url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	now := time.Now()
+	writeCA(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv1.Certificate().Raw}), now.Add(-time.Minute))
+	if err := get(srv1.URL); err != nil {
+		t.Fatalf("httpGet() error = %v", err)
+	}
+	if err := get(srv2URL); err == nil {
+		t.Fatalf("httpGet() verified a server not signed by the CA file")
+	}
+
+	// Rotated CA file
+	rotated, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCA(rotated, now)
+	if err := get(srv2URL); err != nil {
+		t.Errorf("httpGet() error = %v after rotating the CA file", err)
+	}
+
+	// Invalid CA file keeps the previous client
+	writeCA([]byte("invalid"), now.Add(time.Minute))
+	if err := get(srv2URL); err != nil {
+		t.Errorf("httpGet() error = %v after writing an invalid CA file", err)
+	}
+}
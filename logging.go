@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// Level of the default logger, changed by the configuration after startup
+var gLogLevel = new(slog.LevelVar)
+
+// setupLogging configures the default logger with the log format and level of the
+// configuration, debug enables the debug level regardless of logLevel
+func setupLogging(conf *config.AppConfiguration) error {
+	level := slog.LevelInfo
+	if conf.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(conf.LogLevel)); err != nil {
+			return fmt.Errorf("invalid log level %s", conf.LogLevel)
+		}
+	}
+	if conf.Debug {
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{Level: gLogLevel}
+	var handler slog.Handler
+	switch strings.ToLower(conf.LogFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %s", conf.LogFormat)
+	}
+	gLogLevel.Set(level)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// logMessage joins the arguments like fmt.Sprintln without the trailing newline
+func logMessage(msg ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(msg...), "\n")
+}
+
+func logInfo(msg ...interface{}) {
+	slog.Info(logMessage(msg...))
+}
+
+func logDebug(msg ...interface{}) {
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		slog.Debug(logMessage(msg...))
+	}
+}
+
+func logWarn(msg ...interface{}) {
+	slog.Warn(logMessage(msg...))
+}
+
+func logError(msg ...interface{}) {
+	slog.Error(logMessage(msg...))
+}
+
+// logFatal logs an error and exits, replacing log.Fatal to respect the log format
+func logFatal(msg ...interface{}) {
+	logError(msg...)
+	os.Exit(1)
+}
+
+// fetchContext is passed to the fetch functions of a source, holding the metric set
+// being filled, the logger with the source and url fields, the errors reported
+// in the status of the source and the responses shown on its debug page
+type fetchContext struct {
+	set    *metrics.Set
+	source *source
+	logger *slog.Logger
+	debug  *sourceDebug // nil unless debugSourcesEnabled is configured
+
+	mtx    sync.Mutex
+	errors []string
+}
+
+func newFetchContext(s *source) *fetchContext {
+	return &fetchContext{
+		set:    metrics.NewSet(),
+		source: s,
+		logger: slog.Default().With("source", s.name, "url", s.url),
+	}
+}
+
+// errorMessage formats a message and its attributes like the text log format,
+// used for the errors shown in the status of a source
+func errorMessage(msg string, args ...interface{}) string {
+	r := slog.NewRecord(time.Time{}, slog.LevelError, msg, 0)
+	r.Add(args...)
+	var b strings.Builder
+	b.WriteString(msg)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	})
+	return b.String()
+}
+
+func (fc *fetchContext) addError(msg string, args ...interface{}) {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	fc.errors = append(fc.errors, errorMessage(msg, args...))
+}
+
+// fetchErrors returns the errors reported while fetching
+func (fc *fetchContext) fetchErrors() []string {
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	return fc.errors
+}
+
+func logSourceDebug(fc *fetchContext, msg string, args ...interface{}) {
+	fc.logger.Debug(msg, args...)
+}
+
+func logSourceInfo(fc *fetchContext, msg string, args ...interface{}) {
+	fc.logger.Info(msg, args...)
+}
+
+// logSourceError logs an error fetching the metrics of a source and reports it
+// in the status of the source
+func logSourceError(fc *fetchContext, msg string, args ...interface{}) {
+	fc.logger.Error(msg, args...)
+	fc.addError(msg, args...)
+}
+
+// repeatedErrors counts the connection errors of a source suppressed since the
+// last logged error
+type repeatedErrors struct {
+	logged     time.Time
+	suppressed int
+}
+
+var gRepeatedErrors map[string]*repeatedErrors
+var repeatedErrorsMtx sync.Mutex
+
+// logConnectError logs a failed request of a source like logSourceError. While the
+// source stays unreachable, the error is logged once per logRepeatInterval with the
+// number of suppressed errors, the other errors are logged at debug level.
+func logConnectError(fc *fetchContext, msg string, args ...interface{}) {
+	fc.addError(msg, args...)
+
+	interval := config.AppConfig.LogRepeatInterval
+	if interval <= 0 {
+		fc.logger.Error(msg, args...)
+		return
+	}
+	s := fc.source
+	repeatedErrorsMtx.Lock()
+	defer repeatedErrorsMtx.Unlock()
+	if gRepeatedErrors == nil {
+		gRepeatedErrors = make(map[string]*repeatedErrors)
+	}
+	r := gRepeatedErrors[s.name]
+	switch {
+	case r == nil:
+		gRepeatedErrors[s.name] = &repeatedErrors{logged: time.Now()}
+		fc.logger.Error(msg, args...)
+	case time.Since(r.logged) < interval:
+		r.suppressed++
+		fc.logger.Debug(msg, append(args, "suppressed", true)...)
+	default:
+		fc.logger.Error(msg, append(args, "repeated", r.suppressed)...)
+		r.logged, r.suppressed = time.Now(), 0
+	}
+}
+
+// resetRepeatedErrors logs the recovery of a source after connection errors
+func resetRepeatedErrors(s *source) {
+	repeatedErrorsMtx.Lock()
+	defer repeatedErrorsMtx.Unlock()
+	if r, ok := gRepeatedErrors[s.name]; ok {
+		slog.Info("Source reachable again", "source", s.name, "url", s.url, "suppressed", r.suppressed)
+		delete(gRepeatedErrors, s.name)
+	}
+}
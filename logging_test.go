@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_setupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	tests := []struct {
+		name      string
+		conf      config.AppConfiguration
+		wantLevel slog.Level
+		wantErr   bool
+	}{
+		{"defaults", config.AppConfiguration{}, slog.LevelInfo, false},
+		{"json warn", config.AppConfiguration{LogLevel: "warn", LogFormat: "json"}, slog.LevelWarn, false},
+		{"upper case", config.AppConfiguration{LogLevel: "ERROR", LogFormat: "TEXT"}, slog.LevelError, false},
+		{"debug flag", config.AppConfiguration{LogLevel: "error", Debug: true}, slog.LevelDebug, false},
+		{"invalid level", config.AppConfiguration{LogLevel: "verbose"}, 0, true},
+		{"invalid format", config.AppConfiguration{LogFormat: "xml"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setupLogging(&tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setupLogging() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && gLogLevel.Level() != tt.wantLevel {
+				t.Errorf("setupLogging() level = %v, want %v", gLogLevel.Level(), tt.wantLevel)
+			}
+		})
+	}
+}
+
+// testFetchContext returns the context of a test source
+func testFetchContext() *fetchContext {
+	return newFetchContext(&source{name: "test", url: "http://test"})
+}
+
+func Test_errorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		args []interface{}
+		want string
+	}{
+		{"message only", "Failed to get cluster info", nil, "Failed to get cluster info"},
+		{"attributes", "Failed to fetch map detail", []interface{}{"map", "sessionMap", "err", errors.New("timeout")},
+			"Failed to fetch map detail map=sessionMap err=timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorMessage(tt.msg, tt.args...); got != tt.want {
+				t.Errorf("errorMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_logConnectError(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	config.AppConfig.LogRepeatInterval = time.Hour
+	defer func() { config.AppConfig.LogRepeatInterval = 0 }()
+
+	fail := true
+	s := &source{name: "sipproxyd", url: "http://127.0.0.1:9980", fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+		defer wg.Done()
+		if fail {
+			logConnectError(fc, "Failed to connect", "err", "connection refused")
+		}
+	}}
+	for i := 0; i < 3; i++ {
+		s.refresh(0)
+	}
+	if got := strings.Count(buf.String(), "Failed to connect"); got != 1 {
+		t.Errorf("logged %d connection errors within interval, want 1:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "source=sipproxyd url=http://127.0.0.1:9980") {
+		t.Errorf("connection error logged without source and url fields:\n%s", buf.String())
+	}
+	if st := s.lastStatus(); len(st.Errors) != 1 {
+		t.Errorf("lastStatus().Errors = %q, want the suppressed error", st.Errors)
+	}
+
+	// Log the error again with the number of suppressed errors once the interval passed
+	repeatedErrorsMtx.Lock()
+	gRepeatedErrors[s.name].logged = time.Now().Add(-2 * time.Hour)
+	repeatedErrorsMtx.Unlock()
+	buf.Reset()
+	s.refresh(0)
+	if !strings.Contains(buf.String(), "repeated=2") {
+		t.Errorf("repeated connection error logged without count:\n%s", buf.String())
+	}
+
+	fail = false
+	buf.Reset()
+	s.refresh(0)
+	if !strings.Contains(buf.String(), "Source reachable again") {
+		t.Errorf("recovery of source not logged:\n%s", buf.String())
+	}
+	buf.Reset()
+	s.refresh(0)
+	if buf.Len() > 0 {
+		t.Errorf("unexpected log output of reachable source:\n%s", buf.String())
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
@@ -22,9 +25,8 @@ import (
 
 const version = "1.3.2"
 
-// Global metric set
-var metricsMtx sync.Mutex
-var metricSet *metrics.Set
+// Timezone used by C5 for timestamps like the startupTime
+var gTimezone = time.Local
 
 // Fix missing cmpGrp label when C5 component is shutdown
 var gCmpGrp map[string]MetricAttribute
@@ -68,6 +70,9 @@ type c5StateResponse struct {
 	TuQueueStatus           string        // "tuQueueStatus" : "OK - checked: 1830",
 	CounterInfos            []interface{} // "counterInfos": [ ... ]
 	AlarmedTrapInfos        []interface{} // "alarmedTrapInfos": [ ... ]
+
+	ProxyResponseTimeStampAndState    string // "proxyResponseTimeStampAndState" : "2021-02-25 10:31:48  active",
+	ProxyResponseTimeStampAndStateOld string `json:"proxyResponseTimeStampAndState:"` // Workaround for typo (trailing colon)
 }
 
 type c5CounterResponse struct {
@@ -85,23 +90,28 @@ type c5CounterResponse struct {
 	LastAvgValue                   uint64        // "lastAvgValue" : 0, // counter only
 	TotalValue                     uint64        // "totalValue" : 0, // counter only
 	TableValues                    []interface{} // "counterInfos": [ ... ]
-}
 
-type c5MapListResponse struct {
-	ProxyResponseTimeStampAndState string   `json:"proxyResponseTimeStampAndState:"`
-	Maps                           []string `json:"maps"`
+	ProxyResponseTimeStampAndStateOld string `json:"proxyResponseTimeStampAndState:"` // Workaround for typo (trailing colon)
 }
 
-type c5MapDetailResponse struct {
-	ProxyResponseTimeStampAndState string `json:"proxyResponseTimeStampAndState:"`
-	CacheName                      string `json:"cache_name"`
-	CacheSizeEntries               uint64 `json:"cache_size_entries"`
-	CacheSizeBytes                 uint64 `json:"cache_size_bytes"`
-	CacheHits                      uint64 `json:"cache_hits"`
-	CacheMisses                    uint64 `json:"cache_misses"`
-	CacheHitRatioPercent           float64 `json:"cache_hit_ratio_percent"`
+// clusterInfo contains the parsed clusterInfo of a C5 response like
+// "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)"
+type clusterInfo struct {
+	DcID     string
+	Dc       string
+	CmpGrpID string
+	CmpGrp   string
+	MasterID string
 }
 
+var (
+	reClusterDC       = regexp.MustCompile(`{([^{}]+)}`)
+	reClusterDCID     = regexp.MustCompile(`DC=(\d+)`)
+	reClusterCmpGrp   = regexp.MustCompile(`\[([^\[\]]+)\]`)
+	reClusterCmpGrpID = regexp.MustCompile(`CompGrpId=(\d+)`)
+	reClusterMasterID = regexp.MustCompile(`masterId=(\d+)`)
+)
+
 type MetricAttribute struct {
 	name  string
 	value string
@@ -134,30 +144,45 @@ func normalizeMetricName(name string) string {
 	return strings.Trim(name, "_. ")
 }
 
+var reInvalidMetricChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// sanitizeMetricName converts names provided by the upstream systems like
+// "backupEntries" or "sent-sip-invites" to lower case metric names
+func sanitizeMetricName(name string) string {
+	return strings.Trim(reInvalidMetricChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes label values provided by the upstream systems
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
 func appendIndex(idx *int, attrs *[]MetricAttribute) {
 	if idx != nil {
 		*attrs = append(*attrs, MetricAttribute{"idx", fmt.Sprintf(`%d`, *idx)})
 	}
 }
 
-func setUsageMetric(prefix string, metric usageCounter, attrs []MetricAttribute) {
+func setUsageMetric(set *metrics.Set, prefix string, metric usageCounter, attrs []MetricAttribute) {
 	// logDebug("set usage metric for ", prefix, metric.Name)
 	appendIndex(metric.Idx, &attrs)
 	current := buildMetricName(prefix, metric.Name+"_current", attrs)
-	setMetricValue(current, metric.Current)
+	setMetricValue(set, current, metric.Current)
 	lastMin := buildMetricName(prefix, metric.Name+"_lastmin", attrs)
-	setMetricValue(lastMin, metric.LastMin)
+	setMetricValue(set, lastMin, metric.LastMin)
 	lastAvg := buildMetricName(prefix, metric.Name+"_lastavg", attrs)
-	setMetricValue(lastAvg, metric.LastAvg)
+	setMetricValue(set, lastAvg, metric.LastAvg)
 	lastMax := buildMetricName(prefix, metric.Name+"_lastmax", attrs)
-	setMetricValue(lastMax, metric.LastMax)
+	setMetricValue(set, lastMax, metric.LastMax)
 	min := buildMetricName(prefix, metric.Name+"_min", attrs)
-	setMetricValue(min, metric.Min)
+	setMetricValue(set, min, metric.Min)
 	max := buildMetricName(prefix, metric.Name+"_max", attrs)
-	setMetricValue(max, metric.Max)
+	setMetricValue(set, max, metric.Max)
 }
 
-func setLabeledUsageMetric(prefix string, label string, metric usageCounter, attrs []MetricAttribute) {
+func setLabeledUsageMetric(set *metrics.Set, prefix string, label string, metric usageCounter, attrs []MetricAttribute) {
 	//logDebug("set labeled usage metric for ", prefix, metric.Name)
 	attrs = append(attrs, MetricAttribute{label, metric.Name})
 	appendIndex(metric.Idx, &attrs)
@@ -170,52 +195,57 @@ func setLabeledUsageMetric(prefix string, label string, metric usageCounter, att
 	}
 
 	current := buildMetricName(prefix, `current`, attrs)
-	setMetricValue(current, metric.Current)
+	setMetricValue(set, current, metric.Current)
 	lastMin := buildMetricName(prefix, `lastmin`, attrs)
-	setMetricValue(lastMin, metric.LastMin)
+	setMetricValue(set, lastMin, metric.LastMin)
 	lastAvg := buildMetricName(prefix, `lastavg`, attrs)
-	setMetricValue(lastAvg, metric.LastAvg)
+	setMetricValue(set, lastAvg, metric.LastAvg)
 	lastMax := buildMetricName(prefix, `lastmax`, attrs)
-	setMetricValue(lastMax, metric.LastMax)
+	setMetricValue(set, lastMax, metric.LastMax)
 	min := buildMetricName(prefix, `min`, attrs)
-	setMetricValue(min, metric.Min)
+	setMetricValue(set, min, metric.Min)
 	max := buildMetricName(prefix, `_max`, attrs)
-	setMetricValue(max, metric.Max)
+	setMetricValue(set, max, metric.Max)
 }
 
-func setCounterMetric(prefix string, metric eventCounter, attrs []MetricAttribute) {
+func setCounterMetric(set *metrics.Set, prefix string, metric eventCounter, attrs []MetricAttribute) {
 	//logDebug("set counter metric for ", prefix, metric.Name, "attrs:", attrs)
 	appendIndex(metric.Idx, &attrs)
 	current := buildMetricName(prefix, metric.Name+"_total", attrs)
-	setMetricValue(current, metric.Total)
+	setMetricValue(set, current, metric.Total)
 }
 
-func setLabeledCounterMetric(prefix string, label string, metric eventCounter, attrs []MetricAttribute) {
+func setLabeledCounterMetric(set *metrics.Set, prefix string, label string, metric eventCounter, attrs []MetricAttribute) {
 	//logDebug("set labeled counter metric for ", prefix, attrs)
 	attrs = append(attrs, MetricAttribute{label, metric.Name})
 	appendIndex(metric.Idx, &attrs)
 
 	current := buildMetricName(prefix, `total`, attrs)
-	setMetricValue(current, metric.Total)
+	setMetricValue(set, current, metric.Total)
+}
+
+func setBreakdownMetric(set *metrics.Set, prefix string, group string, metric breakdownCounter, attrs []MetricAttribute) {
+	name := metric.Name
+	if group != "" {
+		name = group + "_" + name
+	}
+	for i, t := range metric.Types {
+		tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"type", t})
+		setMetricValue(set, buildMetricName(prefix, name, tmp), metric.Values[i])
+	}
 }
 
-func setMetricValue(name string, value uint64) {
+func setMetricValue(set *metrics.Set, name string, value uint64) {
 	// logDebug("set metric ", name, "value", value)
-	metricsMtx.Lock()
-	defer metricsMtx.Unlock()
-	metricSet.GetOrCreateCounter(name).Set(value)
+	set.GetOrCreateCounter(name).Set(value)
 }
 
-func setFloatMetricValue(name string, value float64) {
-	metricsMtx.Lock()
-	defer metricsMtx.Unlock()
-	metricSet.GetOrCreateFloatCounter(name).Set(value)
+func setFloatMetricValue(set *metrics.Set, name string, value float64) {
+	set.GetOrCreateFloatCounter(name).Set(value)
 }
 
-func setMetricValueFloat(name string, value float64) {
-	metricsMtx.Lock()
-	defer metricsMtx.Unlock()
-	metricSet.GetOrCreateFloatCounter(name).Set(value)
+func setMetricValueFloat(set *metrics.Set, name string, value float64) {
+	set.GetOrCreateFloatCounter(name).Set(value)
 }
 
 func parseInt64(str string) int64 {
@@ -227,7 +257,7 @@ func parseInt64(str string) int64 {
 	// Fallback: try parsing as float (handle scientific notation e.g. 1.15653e+06)
 	f, err := strconv.ParseFloat(str, 64)
 	if err != nil {
-		log.Fatal("Failed to parse as int64:", str)
+		logFatal("Failed to parse as int64:", str)
 	}
 
 	return int64(f) // truncate
@@ -237,6 +267,20 @@ func parseUint64(str string) uint64 {
 	return uint64(parseInt64(str))
 }
 
+// tryParseUint64 parses str like parseUint64, but reports an invalid value to the
+// caller instead of exiting
+func tryParseUint64(str string) (uint64, bool) {
+	i, err := strconv.ParseInt(str, 10, 64)
+	if err == nil {
+		return uint64(i), true
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
 func parseBuildString(build string) (version string) {
 	// "Version: 6.0.2.57, compiled on Jan 15 2020, 13:06:31 built by TELES Communication Systems GmbH",
 	parts := strings.Split(build, ",")
@@ -244,77 +288,128 @@ func parseBuildString(build string) (version string) {
 	return
 }
 
+func parseTimestamp(timestamp string) (time.Time, error) {
+	// "2020-01-19 04:01:04.503", fractional seconds are optional
+	return time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(timestamp), gTimezone)
+}
+
+func parseResponseTimestamp(timestampAndState ...string) (time.Time, error) {
+	// "2021-02-25 10:31:48  active"
+	for _, s := range timestampAndState {
+		fields := strings.Fields(s)
+		if len(fields) >= 2 {
+			return parseTimestamp(fields[0] + " " + fields[1])
+		}
+	}
+	return time.Time{}, fmt.Errorf("missing response timestamp")
+}
+
 func parseClusterInfo(clusterInfo string) (dc string, cmpGrp string) {
+	info := parseClusterInfoDetails(clusterInfo)
+	return info.Dc, info.CmpGrp
+}
+
+func parseClusterInfoDetails(info string) clusterInfo {
 	// DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)
-	reDC := regexp.MustCompile(`{([^{}]+)}`)
-	reCmpGrp := regexp.MustCompile(`\[([^\[\]]+)\]`)
-	res := reDC.FindStringSubmatch(clusterInfo)
-	if len(res) > 1 {
-		dc = res[1]
+	match := func(re *regexp.Regexp) string {
+		res := re.FindStringSubmatch(info)
+		if len(res) > 1 {
+			return res[1]
+		}
+		return ""
 	}
-	res = reCmpGrp.FindStringSubmatch(clusterInfo)
-	if len(res) > 1 {
-		cmpGrp = res[1]
+	return clusterInfo{
+		DcID:     match(reClusterDCID),
+		Dc:       match(reClusterDC),
+		CmpGrpID: match(reClusterCmpGrpID),
+		CmpGrp:   match(reClusterCmpGrp),
+		MasterID: match(reClusterMasterID),
 	}
-	return
 }
 
-func parseDataSize(str string) uint64 {
+func parseDataSize(str string) (uint64, bool) {
 	unit := strings.TrimLeft(str, "0123456789")
-	size := parseUint64(strings.TrimSuffix(str, unit))
+	size, ok := tryParseUint64(strings.TrimSuffix(str, unit))
 	switch strings.ToLower(unit) {
 	case "kb":
-		return size * 1024
+		return size * 1024, ok
 	case "mb":
-		return size * 1024 * 1024
+		return size * 1024 * 1024, ok
 	case "gb":
-		return size * 1024 * 1024 * 1024
+		return size * 1024 * 1024 * 1024, ok
 	case "tb":
-		return size * 1024 * 1024 * 1024 * 1024
+		return size * 1024 * 1024 * 1024 * 1024, ok
 	}
-	return size
+	return size, ok
+}
+
+// memoryUsage contains the parsed memoryUsage of a C5 state response
+type memoryUsage struct {
+	Health      string // C5 heap health, e.g. "OK", "WARNING" or "CRITICAL"
+	UsedPercent uint64
+	Used        uint64
+	UsedMin     uint64 // R6.2 or newer only
+	UsedMax     uint64 // R6.2 or newer only
+	Total       uint64
+	MaxPercent  uint64
+	UpdCtr      uint64 // Update counter, stale if not increasing
+	HasUpdCtr   bool   // UpdCtr was reported and valid
 }
 
-func parseMemoryString(memoryUsage string) (memUsed, memTotal, memMaxUsage uint64) {
+// parseMemoryUsage parses the memoryUsage of a C5 state response. Invalid values are
+// left zero and returned as error.
+func parseMemoryUsage(memoryUsage string) (mem memoryUsage, err error) {
 	// R6.0: "memoryUsage" : "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793",
 	// R6.2: "memoryUsage" : "C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205",
-	parts := strings.Split(memoryUsage, "-")
-	for _, p := range parts {
+	var invalid []string
+	parseValue := func(value string, parse func(string) (uint64, bool)) uint64 {
+		v, ok := parse(value)
+		if !ok {
+			invalid = append(invalid, value)
+		}
+		return v
+	}
+	for _, p := range strings.Split(memoryUsage, " - ") {
 		param := strings.SplitN(strings.TrimSpace(p), ":", 2)
-		// logDebug("Parsing memory part", p, param)
+		if len(param) < 2 {
+			continue
+		}
 		key := strings.ToLower(strings.TrimSpace(param[0]))
+		value := strings.TrimSpace(param[1])
 		switch key {
+		case "c5 heap health":
+			mem.Health = value
 		case "mem used":
-			if strings.HasSuffix(param[1], "%") { // Need the first "mem used" as percent param
-				continue
-			}
-			if strings.Contains(param[1], "%") { // probably R6.2
-				// logDebug("Parse memused R6.2", param[1])
-				memparts := strings.Fields(param[1])
-				memUsed = parseDataSize(memparts[1])
-			} else {
-				// logDebug("Parse memused R6.0", param[1])
-				memUsed = parseDataSize(strings.TrimSpace(param[1]))
+			// "18%", "383MB" or "3%  76MB  (min: 76 max: 76)", min and max are given in MB
+			fields := strings.Fields(value)
+			for i := 0; i < len(fields); i++ {
+				f := fields[i]
+				switch {
+				case f == "(min:" && i+1 < len(fields):
+					i++
+					mem.UsedMin = parseValue(fields[i]+"MB", parseDataSize)
+				case f == "max:" && i+1 < len(fields):
+					i++
+					mem.UsedMax = parseValue(strings.TrimSuffix(fields[i], ")")+"MB", parseDataSize)
+				case strings.HasSuffix(f, "%"):
+					mem.UsedPercent = parseValue(strings.TrimSuffix(f, "%"), tryParseUint64)
+				case f[0] >= '0' && f[0] <= '9':
+					mem.Used = parseValue(f, parseDataSize)
+				}
 			}
 		case "mem total":
-			memTotal = parseDataSize(strings.TrimSpace(param[1]))
+			mem.Total = parseValue(value, parseDataSize)
 		case "max":
-			memMaxUsage = parseUint64(strings.TrimSuffix(strings.TrimSpace(param[1]), "%"))
+			mem.MaxPercent = parseValue(strings.TrimSuffix(value, "%"), tryParseUint64)
+		case "updctr":
+			if mem.UpdCtr, mem.HasUpdCtr = tryParseUint64(value); !mem.HasUpdCtr {
+				invalid = append(invalid, value)
+			}
 		}
 	}
-	return
-}
-
-func parseMemoryStringRegex(memoryUsage string) (memUsed, memTotal, memMaxUsage uint64) {
-	// R6.0: "memoryUsage" : "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793",
-	// R6.2: "memoryUsage" : "C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205",
-	memRegex := regexp.MustCompile(`(?i)mem used:(?: *\d+%)? *(\d+[tgmkb]*) .* mem total: *(\d+[tgmkb]*).* max: *(\d+)%`)
-	matches := memRegex.FindStringSubmatch(memoryUsage)
-	if len(matches) > 1 {
-		// logDebug("matches:", matches[1:4])
-		return parseDataSize(matches[1]), parseDataSize(matches[2]), parseUint64(matches[3])
+	if len(invalid) > 0 {
+		err = fmt.Errorf("invalid values %q", invalid)
 	}
-	logError("Failed to parse memory usage:", memoryUsage)
 	return
 }
 
@@ -343,6 +438,50 @@ func parseQueueStateString(state string) uint64 {
 	return 0
 }
 
+var reTuQueueChecked = regexp.MustCompile(`checked: *(\d+)`)
+
+func parseTuQueueStatus(status string) (state string, checked uint64, hasChecked bool) {
+	// "tuQueueStatus" : "OK - checked: 1830",
+	state = strings.TrimSpace(strings.SplitN(status, " - ", 2)[0])
+	res := reTuQueueChecked.FindStringSubmatch(status)
+	if len(res) > 1 {
+		if c, err := strconv.ParseUint(res[1], 10, 64); err == nil {
+			return state, c, true
+		}
+	}
+	return state, 0, false
+}
+
+var reBreakdown = regexp.MustCompile(`^\s+(\w+)\s*\(([^()]+)\):\s*([\d, ]+)$`)
+
+// breakdownCounter is an indented line following a counter, breaking it down by type
+type breakdownCounter struct {
+	Name   string
+	Types  []string
+	Values []uint64
+}
+
+func parseBreakdownCounter(line string) (c breakdownCounter, ok bool) {
+	// " 75 PRESENCE_ACTIVE_SUBSCRIPTIONS                       36     36     36     36     36     36       2045",
+	// "    OBSERVERS  (dialog,csta,reg):  36,0,0",
+	res := reBreakdown.FindStringSubmatch(line)
+	if len(res) < 4 {
+		return c, false
+	}
+	c.Name = normalizeMetricName(res[1])
+	types := strings.Split(res[2], ",")
+	values := strings.Split(res[3], ",")
+	for i := 0; i < len(types) && i < len(values); i++ {
+		value, err := strconv.ParseUint(strings.TrimSpace(values[i]), 10, 64)
+		if err != nil {
+			return c, false
+		}
+		c.Types = append(c.Types, strings.TrimSpace(types[i]))
+		c.Values = append(c.Values, value)
+	}
+	return c, len(c.Values) > 0
+}
+
 func parseUsageCounter(line string) usageCounter {
 	// "       Usage counters                              current    min    max   lMin   lMax   lAvg",
 	// " 45 CALL_CONTROL_ACTIVE_CALLS                           0      0      0      0      0      0",
@@ -377,7 +516,7 @@ func parseUsageCounter(line string) usageCounter {
 	return res
 }
 
-func parseSubUsageCounter(prefix string, lines []string) (cnts []usageCounter) {
+func parseSubUsageCounter(fc *fetchContext, prefix string, lines []string) (cnts []usageCounter) {
 	// [
 	//   " 84 TRANSACTION_AND_TU_TU_MANAGER_QUEUE_SIZE          0      0      3      0      9      0",
 	//   "                                                      0      0      3      0      4      0",
@@ -390,7 +529,7 @@ func parseSubUsageCounter(prefix string, lines []string) (cnts []usageCounter) {
 		if i == 0 {
 			c := parseUsageCounter(line)
 			if c.Name == "" {
-				logError(prefix, "> failed to parse as sub usage counter header:", line)
+				logSourceError(fc, "Failed to parse sub usage counter header", "prefix", prefix, "line", line)
 				return
 			}
 			c.Idx = &idx
@@ -400,7 +539,7 @@ func parseSubUsageCounter(prefix string, lines []string) (cnts []usageCounter) {
 		} else {
 			parts := strings.Fields(line)
 			if len(parts) < 6 {
-				logError(prefix, "> failed to parse as sub usage counter:", line)
+				logSourceError(fc, "Failed to parse sub usage counter", "prefix", prefix, "line", line)
 				continue
 			}
 			cnts = append(cnts,
@@ -434,7 +573,7 @@ func parseEventCounter(line string) eventCounter {
 	}
 }
 
-func parseSubEventCounter(prefix string, lines []string) (cnts []eventCounter) {
+func parseSubEventCounter(fc *fetchContext, prefix string, lines []string) (cnts []eventCounter) {
 	// [
 	//   "425 CASS_ERR_CONN_TMO                                  0      0      0",
 	//   "                                                     131    386    518"
@@ -447,7 +586,7 @@ func parseSubEventCounter(prefix string, lines []string) (cnts []eventCounter) {
 		if i == 0 {
 			c := parseEventCounter(line)
 			if c.Name == "" {
-				logError(prefix, "> failed to parse as sub event counter header:", line)
+				logSourceError(fc, "Failed to parse sub event counter header", "prefix", prefix, "line", line)
 				return
 			}
 			c.Idx = &idx
@@ -457,7 +596,7 @@ func parseSubEventCounter(prefix string, lines []string) (cnts []eventCounter) {
 		} else {
 			parts := strings.Fields(line)
 			if len(parts) < 1 {
-				logError(prefix, "> failed to parse as sub event counter:", line)
+				logSourceError(fc, "Failed to parse sub event counter", "prefix", prefix, "line", line)
 				return
 			}
 			cnts = append(cnts,
@@ -472,9 +611,12 @@ func parseSubEventCounter(prefix string, lines []string) (cnts []eventCounter) {
 	return
 }
 
-func processC5StateCounter(prefix string, lines []interface{}, attrs []MetricAttribute) {
+func processC5StateCounter(fc *fetchContext, daemon config.DaemonConfig, lines []interface{}, attrs []MetricAttribute) {
+	set := fc.set
 	const event, usage string = "event", "usage"
+	prefix := daemon.Prefix
 	var cntType string
+	var lastCounter string
 	for _, line := range lines {
 		v := reflect.ValueOf(line)
 		switch v.Kind() {
@@ -483,48 +625,83 @@ func processC5StateCounter(prefix string, lines []interface{}, attrs []MetricAtt
 			for i := 0; i < v.Len(); i++ {
 				sublines[i] = v.Index(i).Elem().String()
 			}
+			joined := strings.Join(sublines, "\n")
 			if cntType == usage {
-				cnts := parseSubUsageCounter(prefix, sublines)
+				cnts := parseSubUsageCounter(fc, prefix, sublines)
+				if len(cnts) == 0 {
+					debugParsedLine(fc, debugIgnored, joined, "invalid sub usage counter header")
+				} else {
+					debugParsedLine(fc, debugSubUsage, joined, "")
+				}
 				for _, c := range cnts {
-					setUsageMetric(prefix, c, attrs)
+					setUsageMetric(set, prefix, c, attrs)
 				}
 			} else if cntType == event {
 				// Workaround for CSTAGW
 				// see https://github.com/communi5/prometheus-c5-exporter/issues/1
-				if prefix == "cstagwd" && len(sublines) < 2 {
-					logDebug("Ignore invalid event sublines for cstagwd", sublines)
+				if daemon.IgnoreIncompleteSubEvents && len(sublines) < 2 {
+					logSourceDebug(fc, "Ignoring incomplete event sublines", "prefix", prefix, "lines", sublines)
+					debugParsedLine(fc, debugIgnored, joined, "incomplete sub event counter (ignoreIncompleteSubEvents)")
 					continue
 				}
-				cnts := parseSubEventCounter(prefix, sublines)
+				cnts := parseSubEventCounter(fc, prefix, sublines)
+				if len(cnts) == 0 {
+					debugParsedLine(fc, debugIgnored, joined, "invalid sub event counter header")
+				} else {
+					debugParsedLine(fc, debugSubEvent, joined, "")
+				}
 				for _, c := range cnts {
-					setCounterMetric(prefix, c, attrs)
+					setCounterMetric(set, prefix, c, attrs)
 				}
 			} else {
-				logDebug(prefix, "ignoring line for unknown type", sublines)
+				logSourceDebug(fc, "Ignoring sublines of unknown counter type", "prefix", prefix, "lines", sublines)
+				debugParsedLine(fc, debugIgnored, joined, "sub counter before Event or Usage counters header")
 			}
 		case reflect.String:
 			l := line.(string)
 			if strings.Contains(l, "Event counters") {
 				cntType = event
+				debugParsedLine(fc, debugIgnored, l, "Event counters header")
 				continue
 			} else if strings.Contains(l, "Usage counters") {
 				cntType = usage
+				debugParsedLine(fc, debugIgnored, l, "Usage counters header")
 				continue
 			} else if strings.HasPrefix(l, "    ") {
-				// Skip unknown elements like the OBSERVERS line:
+				// Breakdown of the previous counter like the OBSERVERS line, named
+				// using the group of the previous counter (presence_observers):
 				// " 75 PRESENCE_ACTIVE_SUBSCRIPTIONS                       36     36     36     36     36     36       2045",
 				// "    OBSERVERS  (dialog,csta,reg):  36,0,0",
-				logDebug(prefix, "ignore line", l)
+				if c, ok := parseBreakdownCounter(l); ok {
+					setBreakdownMetric(set, prefix, strings.SplitN(lastCounter, "_", 2)[0], c, attrs)
+					debugParsedLine(fc, debugBreakdown, l, "")
+				} else {
+					logSourceDebug(fc, "Ignoring line without breakdown values", "prefix", prefix, "line", l)
+					debugParsedLine(fc, debugIgnored, l, "indented line without breakdown values")
+				}
 				continue
 			}
 			if cntType == usage {
 				c := parseUsageCounter(l)
-				setUsageMetric(prefix, c, attrs)
+				setUsageMetric(set, prefix, c, attrs)
+				lastCounter = c.Name
+				if c.Name == "" {
+					debugParsedLine(fc, debugUsage, l, "less than 8 fields, exported without name")
+				} else {
+					debugParsedLine(fc, debugUsage, l, "")
+				}
 			} else if cntType == event {
 				c := parseEventCounter(l)
-				setCounterMetric(prefix, c, attrs)
+				setCounterMetric(set, prefix, c, attrs)
+				lastCounter = c.Name
+				if c.Name == "" {
+					debugParsedLine(fc, debugEvent, l, "less than 3 fields, exported without name")
+				} else {
+					debugParsedLine(fc, debugEvent, l, "")
+				}
 			} else {
-				logDebug(prefix, "ignoring line", l)
+				logSourceDebug(fc, "Ignoring line of unknown counter type", "prefix", prefix, "line", l)
+				debugParsedLine(fc, debugIgnored, l, "line before Event or Usage counters header")
 			}
 			// logDebug("line type", cntType, line)
 		}
@@ -550,46 +727,63 @@ func processC5StateCounter(prefix string, lines []interface{}, attrs []MetricAtt
 //	  ],
 //	  "tableCountInfo" : "curComponentCount2: 14 (10000) "
 //	}
-func processC5CounterMetrics(basePrefix string, data c5CounterResponse, attrs []MetricAttribute) {
+//
+// Table rows are exported as <prefix>_<counter>_<table>_... series using the given label
+// for the row name, e.g. sipproxyd_bt_calls_limit_reached_trunk_total{name="trunk2.otherprovider.at"}.
+// The current values of usage counters are returned by row name.
+func processC5CounterMetrics(fc *fetchContext, basePrefix, table, label string, data c5CounterResponse, attrs []MetricAttribute) (current map[string]uint64) {
+	set := fc.set
 	const event, usage string = "EVENT", "USAGE"
 	prefix := basePrefix + "_" + strings.ToLower(data.CounterName)
 
-	setMetricValue(buildMetricName(prefix, `current`, attrs), data.CurrentValue)
-	logDebug("Processing", prefix, "type", data.CounterType)
+	setMetricValue(set, buildMetricName(prefix, `current`, attrs), data.CurrentValue)
+	if data.CounterName != "" {
+		// One family per daemon, the counter label distinguishes the responses
+		tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"counter", escapeLabelValue(strings.ToLower(data.CounterName))})
+		processResponseTimestamp(fc, basePrefix, tmp, data.ProxyResponseTimeStampAndState, data.ProxyResponseTimeStampAndStateOld)
+	}
+	logSourceDebug(fc, "Processing counter", "prefix", prefix, "type", data.CounterType)
 	if data.CounterType == event {
-		setMetricValue(buildMetricName(prefix, `total`, attrs), data.AbsoluteValue)
-		setMetricValue(buildMetricName(prefix, `last`, attrs), data.LastValue)
+		setMetricValue(set, buildMetricName(prefix, `total`, attrs), data.AbsoluteValue)
+		setMetricValue(set, buildMetricName(prefix, `last`, attrs), data.LastValue)
 	} else {
-		// setMetricValue(prefix+`_current_min`, data.MinValue)
-		// setMetricValue(prefix+`_current_max`, data.MaxValue)
-		setMetricValue(buildMetricName(prefix, `lastavg`, attrs), data.LastAvgValue)
-		setMetricValue(buildMetricName(prefix, `lastmin`, attrs), data.LastMinValue)
-		setMetricValue(buildMetricName(prefix, `lastmax`, attrs), data.LastMaxValue)
+		// setMetricValue(set, prefix+`_current_min`, data.MinValue)
+		// setMetricValue(set, prefix+`_current_max`, data.MaxValue)
+		setMetricValue(set, buildMetricName(prefix, `lastavg`, attrs), data.LastAvgValue)
+		setMetricValue(set, buildMetricName(prefix, `lastmin`, attrs), data.LastMinValue)
+		setMetricValue(set, buildMetricName(prefix, `lastmax`, attrs), data.LastMaxValue)
 	}
 	// Parse values now
+	current = make(map[string]uint64)
 	for _, line := range data.TableValues {
 		v := reflect.ValueOf(line)
 		switch v.Kind() {
 		case reflect.String:
 			l := line.(string)
 			if strings.HasPrefix(l, "name") {
+				debugParsedLine(fc, debugIgnored, l, "table header")
 				continue
 			}
 			if data.CounterType == usage {
 				c := parseUsageCounter("0 " + l)
-				setLabeledUsageMetric(prefix+"_trunk", "name", c, attrs)
+				setLabeledUsageMetric(set, prefix+"_"+table, label, c, attrs)
+				current[c.Name] = c.Current
+				debugParsedLine(fc, debugTable, l, "")
 			} else if data.CounterType == event {
 				c := parseEventCounter("0 " + l)
-				setLabeledCounterMetric(prefix+"_trunk", "name", c, attrs)
+				setLabeledCounterMetric(set, prefix+"_"+table, label, c, attrs)
+				debugParsedLine(fc, debugTable, l, "")
 			} else {
-				logDebug(prefix, "ignoring line", l)
+				logSourceDebug(fc, "Ignoring line of unknown counter type", "prefix", prefix, "type", data.CounterType, "line", l)
+				debugParsedLine(fc, debugIgnored, l, "unknown counter type "+data.CounterType)
 			}
 		}
 	}
 	return
 }
 
-func processBaseMetrics(prefix string, state c5StateResponse, attrs []MetricAttribute) {
+func processBaseMetrics(fc *fetchContext, prefix string, state c5StateResponse, attrs []MetricAttribute) {
+	set := fc.set
 	// Set build version in info string
 	version := parseBuildString(state.BuildVersion)
 	if version == "" { // Workaround for typo in sessionconsole before R6.2
@@ -602,18 +796,129 @@ func processBaseMetrics(prefix string, state c5StateResponse, attrs []MetricAttr
 	tmp := append(attrs, MetricAttribute{"version", version})
 	tmp = append(tmp, MetricAttribute{"starttime", startupTime})
 	tmp = append(tmp, MetricAttribute{"state", strings.TrimSpace(strings.Join([]string{state.ProxyState, state.QueueState, state.RegistrarState, state.NotificationServerState, state.CstaState}, " "))})
-	logInfo("Processed", prefix, tmp)
-	setMetricValue(buildMetricName(prefix, `info`, tmp), 1)
+	logSourceDebug(fc, "Processed state", "prefix", prefix, "version", version, "starttime", startupTime)
+	setMetricValue(set, buildMetricName(prefix, `info`, tmp), 1)
+
+	// Set start time and restarts detected by the exporter
+	if startTime, err := parseTimestamp(startupTime); err == nil {
+		restarts, restarted := trackRestarts(prefix, startTime)
+		if restarted {
+			logSourceInfo(fc, "Detected restart", "prefix", prefix, "starttime", startupTime)
+		}
+		setFloatMetricValue(set, buildMetricName(prefix, `start_time_seconds`, attrs), float64(startTime.UnixMilli())/1000)
+		setMetricValue(set, buildMetricName(prefix, `restarts_total`, attrs), restarts)
+	} else {
+		logSourceDebug(fc, "Failed to parse startup time", "prefix", prefix, "starttime", startupTime, "err", err)
+	}
 
 	// Set process/queue states (usually active=1 or inactive=0)
-	setMetricValue(buildMetricName(prefix, `state`, attrs), parseProcessStateString(state.ProxyState, state.QueueState, state.RegistrarState, state.NotificationServerState, state.CstaState))
-	setMetricValue(buildMetricName(prefix, `tu_queue_state`, attrs), parseQueueStateString(state.TuQueueStatus))
-
-	// Set process state (usually active=1 or inactive=0)
-	memUsed, memTotal, memMaxUsage := parseMemoryString(state.MemoryUsage)
-	setMetricValue(buildMetricName(prefix, `memory_used_bytes`, attrs), memUsed)
-	setMetricValue(buildMetricName(prefix, `memory_total_bytes`, attrs), memTotal)
-	setMetricValue(buildMetricName(prefix, `memory_max_used_percent`, attrs), memMaxUsage)
+	setMetricValue(set, buildMetricName(prefix, `state`, attrs), parseProcessStateString(state.ProxyState, state.QueueState, state.RegistrarState, state.NotificationServerState, state.CstaState))
+	setMetricValue(set, buildMetricName(prefix, `tu_queue_state`, attrs), parseQueueStateString(state.TuQueueStatus))
+	processTuQueueStatus(fc, prefix, state.TuQueueStatus, attrs)
+
+	// Set memory usage and C5 heap health
+	mem, err := parseMemoryUsage(state.MemoryUsage)
+	if err != nil || (mem.Health == "" && state.MemoryUsage != "") {
+		logSourceError(fc, "Failed to parse memory usage", "prefix", prefix, "memoryUsage", state.MemoryUsage, "err", err)
+	}
+	processMemoryUsage(set, prefix, mem, attrs)
+}
+
+func processTuQueueStatus(fc *fetchContext, prefix string, status string, attrs []MetricAttribute) {
+	set := fc.set
+	if status == "" {
+		return
+	}
+	state, checked, hasChecked := parseTuQueueStatus(status)
+	tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"state", escapeLabelValue(state)})
+	setMetricValue(set, buildMetricName(prefix, `tu_queue_status`, tmp), 1)
+	if !hasChecked {
+		return
+	}
+
+	// A checked count which stopped moving indicates a hung TU queue
+	since := unchangedSince(prefix+"_tu_queue_checked", checked, time.Now())
+	var stuck uint64
+	if stuckAfter := config.AppConfig.TuQueueStuckAfter; stuckAfter > 0 && time.Since(since) >= stuckAfter {
+		stuck = 1
+		logSourceDebug(fc, "TU queue checked count not moving", "prefix", prefix, "status", status)
+	}
+	setMetricValue(set, buildMetricName(prefix, `tu_queue_checked`, attrs), checked)
+	setMetricValue(set, buildMetricName(prefix, `tu_queue_stuck`, attrs), stuck)
+}
+
+func processMemoryUsage(set *metrics.Set, prefix string, mem memoryUsage, attrs []MetricAttribute) {
+	setMetricValue(set, buildMetricName(prefix, `memory_used_bytes`, attrs), mem.Used)
+	setMetricValue(set, buildMetricName(prefix, `memory_used_percent`, attrs), mem.UsedPercent)
+	setMetricValue(set, buildMetricName(prefix, `memory_total_bytes`, attrs), mem.Total)
+	setMetricValue(set, buildMetricName(prefix, `memory_max_used_percent`, attrs), mem.MaxPercent)
+	if mem.UsedMax > 0 {
+		setMetricValue(set, buildMetricName(prefix, `memory_used_min_bytes`, attrs), mem.UsedMin)
+		setMetricValue(set, buildMetricName(prefix, `memory_used_max_bytes`, attrs), mem.UsedMax)
+	}
+
+	if mem.Health != "" {
+		processMemoryHealth(set, prefix, mem.Health, attrs)
+	}
+	if !mem.HasUpdCtr {
+		return
+	}
+
+	// The update counter is increased by C5 on each memory check
+	since := unchangedSince(prefix+"_memory_update_counter", mem.UpdCtr, time.Now())
+	var stale uint64
+	if staleAfter := config.AppConfig.MemoryStaleAfter; staleAfter > 0 && time.Since(since) >= staleAfter {
+		stale = 1
+	}
+	setMetricValue(set, buildMetricName(prefix, `memory_update_counter`, attrs), mem.UpdCtr)
+	setMetricValue(set, buildMetricName(prefix, `memory_stale`, attrs), stale)
+}
+
+// processMemoryHealth exports the C5 heap health as state set, including unknown
+// states reported by C5
+func processMemoryHealth(set *metrics.Set, prefix string, health string, attrs []MetricAttribute) {
+	healthStates := []string{"OK", "WARNING", "CRITICAL"}
+	if health != "OK" && health != "WARNING" && health != "CRITICAL" {
+		healthStates = append(healthStates, health)
+	}
+	for _, state := range healthStates {
+		var value uint64
+		if state == health {
+			value = 1
+		}
+		tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"state", escapeLabelValue(state)})
+		setMetricValue(set, buildMetricName(prefix, `memory_health`, tmp), value)
+	}
+}
+
+// processResponseTimestamp exports the timestamp of a C5 response and its skew against
+// the exporter clock (positive if the C5 clock is ahead), revealing stale responses
+// and nodes with broken time synchronization
+func processResponseTimestamp(fc *fetchContext, prefix string, attrs []MetricAttribute, timestampAndState ...string) {
+	set := fc.set
+	ts, err := parseResponseTimestamp(timestampAndState...)
+	if err != nil {
+		logSourceDebug(fc, "Failed to parse response timestamp", "prefix", prefix, "timestamp", timestampAndState, "err", err)
+		return
+	}
+	setFloatMetricValue(set, buildMetricName(prefix, `response_timestamp_seconds`, attrs), float64(ts.Unix()))
+	setFloatMetricValue(set, buildMetricName(prefix, `clock_skew_seconds`, attrs), ts.Sub(time.Now()).Seconds())
+}
+
+func processClusterInfo(set *metrics.Set, prefix string, info clusterInfo, nodeID string, attrs []MetricAttribute) {
+	tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"dc_id", info.DcID}, MetricAttribute{"cmpGrp_id", info.CmpGrpID})
+	setMetricValue(set, buildMetricName(prefix, `cluster_info`, tmp), 1)
+	if info.MasterID == "" {
+		return
+	}
+	setMetricValue(set, buildMetricName(prefix, `cluster_master_id`, attrs), parseUint64(info.MasterID))
+	if nodeID != "" {
+		var isMaster uint64
+		if info.MasterID == nodeID {
+			isMaster = 1
+		}
+		setMetricValue(set, buildMetricName(prefix, `cluster_is_master`, attrs), isMaster)
+	}
 }
 
 func getGlobalAttrs(prefix string) []MetricAttribute {
@@ -640,115 +945,74 @@ func setGlobalAttrs(prefix string, cmpGrp string, dc string) {
 	gDc[prefix] = MetricAttribute{"dc", dc}
 }
 
-func fetchC5StateMetrics(prefix, url string, wg *sync.WaitGroup) {
+func fetchC5StateMetrics(fc *fetchContext, daemon config.DaemonConfig, wg *sync.WaitGroup) {
 	defer wg.Done()
-	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+	set := fc.set
+	prefix := daemon.Prefix
+	resp, err := httpGet(daemon.TLS, daemon.StateURL)
 	if err != nil {
-		logError("Failed to connect", err)
-		setMetricValue(buildMetricName(prefix, "up", getGlobalAttrs(prefix)), 0)
-		setMetricValue(buildMetricName(prefix, "state", getGlobalAttrs(prefix)), 0)
+		logConnectError(fc, "Failed to connect", "err", err)
+		setMetricValue(set, buildMetricName(prefix, "up", getGlobalAttrs(prefix)), 0)
+		setMetricValue(set, buildMetricName(prefix, "state", getGlobalAttrs(prefix)), 0)
 		return
 	}
 	defer resp.Body.Close()
 
 	var c5state c5StateResponse
 	// logDebug("Parsing response body", resp.Body)
-	err = json.NewDecoder(resp.Body).Decode(&c5state)
+	err = json.NewDecoder(debugBody(fc, daemon.StateURL, resp.Body)).Decode(&c5state)
 	if err != nil {
-		logError("Failed to parse response, err: ", err)
+		logSourceError(fc, "Failed to parse response", "err", err)
 		return
 	}
 
-	dc, cmpGrp := parseClusterInfo(c5state.ClusterInfo)
-	attrs := []MetricAttribute{{"dc", dc}, {"cmpGrp", cmpGrp}}
-	setMetricValue(buildMetricName(prefix, "up", attrs), 1)
-	setGlobalAttrs(prefix, cmpGrp, dc)
+	info := parseClusterInfoDetails(c5state.ClusterInfo)
+	attrs := []MetricAttribute{{"dc", info.Dc}, {"cmpGrp", info.CmpGrp}}
+	setMetricValue(set, buildMetricName(prefix, "up", attrs), 1)
+	setGlobalAttrs(prefix, info.CmpGrp, info.Dc)
 
 	// process base information
-	processBaseMetrics(prefix, c5state, attrs)
+	processBaseMetrics(fc, prefix, c5state, attrs)
+	processClusterInfo(set, prefix, info, daemon.NodeID, attrs)
+	processResponseTimestamp(fc, prefix, attrs, c5state.ProxyResponseTimeStampAndState, c5state.ProxyResponseTimeStampAndStateOld)
 
 	// process event and usage counters now
-	processC5StateCounter(prefix, c5state.CounterInfos, attrs)
+	processC5StateCounter(fc, daemon, c5state.CounterInfos, attrs)
 }
 
-func fetchC5CounterMetrics(prefix, url string, wg *sync.WaitGroup) {
+func fetchC5CounterMetrics(fc *fetchContext, prefix, table, label, url string, tlsConf config.TLSConfig, wg *sync.WaitGroup) {
 	defer wg.Done()
-	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+	fetchC5CounterTable(fc, prefix, table, label, url, tlsConf)
+}
+
+// fetchC5CounterTable fetches and processes a C5 counter table, returning the current
+// values of a usage counter by row name. ok is false if the table could not be fetched.
+func fetchC5CounterTable(fc *fetchContext, prefix, table, label, url string, tlsConf config.TLSConfig) (current map[string]uint64, ok bool) {
+	set := fc.set
+	resp, err := httpGet(tlsConf, url)
 	if err != nil {
-		logError("Failed to connect", err)
-		setMetricValue(buildMetricName(prefix, "up", getGlobalAttrs(prefix)), 0)
-		setMetricValue(buildMetricName(prefix, "state", getGlobalAttrs(prefix)), 0)
-		return
+		logConnectError(fc, "Failed to connect", "err", err)
+		setMetricValue(set, buildMetricName(prefix, "up", getGlobalAttrs(prefix)), 0)
+		setMetricValue(set, buildMetricName(prefix, "state", getGlobalAttrs(prefix)), 0)
+		return nil, false
 	}
 	defer resp.Body.Close()
 
 	var c5Resp c5CounterResponse
 	// logDebug("Parsing response body", resp.Body)
-	err = json.NewDecoder(resp.Body).Decode(&c5Resp)
+	err = json.NewDecoder(debugBody(fc, url, resp.Body)).Decode(&c5Resp)
 	if err != nil {
-		logError("Failed to parse response, err: ", err)
-		return
+		logSourceError(fc, "Failed to parse response", "err", err)
+		return nil, false
 	}
 
 	dc, cmpGrp := parseClusterInfo(c5Resp.ClusterInfo)
 	attrs := []MetricAttribute{{"dc", dc}, {"cmpGrp", cmpGrp}}
-	setMetricValue(buildMetricName(prefix, "up", attrs), 1)
+	setMetricValue(set, buildMetricName(prefix, "up", attrs), 1)
 	setGlobalAttrs(prefix, cmpGrp, dc)
 
 	// process event and usage counters now
-	processC5CounterMetrics(prefix, c5Resp, attrs)
-}
-
-func fetchC5HazelcastMetrics(prefix, baseURL string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	client := http.Client{Timeout: 2 * time.Second}
-
-	// 1) fetch list of maps
-	listURL := baseURL + "?95&0"
-	resp, err := client.Get(listURL)
-	if err != nil {
-		logError("Failed to fetch map list:", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	var listResp c5MapListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
-		logError("Failed to decode map list:", err)
-		return
-	}
-
-	attrsBase := getGlobalAttrs(prefix)
-
-	// 2) fetch details for each map
-	for _, mapName := range listResp.Maps {
-		detailURL := baseURL + "?92&31&" + mapName
-
-		resp, err := client.Get(detailURL)
-		if err != nil {
-			logError("Failed to fetch map detail for", mapName, ":", err)
-			continue
-		}
-
-		var detail c5MapDetailResponse
-		if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
-			logError("Failed to decode map detail for", mapName, ":", err)
-			resp.Body.Close()
-			continue
-		}
-		resp.Body.Close()
-
-		attrs := append(attrsBase, MetricAttribute{"map", detail.CacheName})
-
-		setMetricValue(buildMetricName(prefix+"_hazelcast_cache", "size_entries", attrs), detail.CacheSizeEntries)
-		setMetricValue(buildMetricName(prefix+"_hazelcast_cache", "size_bytes", attrs), detail.CacheSizeBytes)
-		setMetricValue(buildMetricName(prefix+"_hazelcast_cache", "hits", attrs), detail.CacheHits)
-		setMetricValue(buildMetricName(prefix+"_hazelcast_cache", "misses", attrs), detail.CacheMisses)
-		setFloatMetricValue(buildMetricName(prefix+"_hazelcast_cache", "hit_ratio_percent", attrs), detail.CacheHitRatioPercent)
-	}
+	return processC5CounterMetrics(fc, prefix, table, label, c5Resp, attrs), true
 }
 
 // ---------------------------- XML struct For XMS REST API
@@ -791,29 +1055,20 @@ type Resource struct {
 
 // ---------------------------- Fetch For XMS REST API
 
-func fetchXmsMetrics(prefix, url string, user string, pwd string, wg *sync.WaitGroup) {
-	logDebug("fetchXmsMetrics with prefix ", prefix, "from url", url)
+func fetchXmsMetrics(fc *fetchContext, target config.XmsTarget, endpoint string, wg *sync.WaitGroup) {
 	defer wg.Done()
-	// Disable of certificate checks required for XMS in case HTTPS is used
-	// Failed to connect Get "https://127.0.0.1:10443/resource/counters":
-	//   x509: cannot validate certificate for XMS because it doesn't contain any IP SANs
-	tr := &http.Transport{
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		DisableKeepAlives: true,
+	set := fc.set
+	url := target.CountersURL
+	if endpoint == xmsLicenses {
+		url = target.LicensesURL
 	}
-	client := http.Client{Timeout: 2 * time.Second, Transport: tr}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	req.SetBasicAuth(user, pwd)
+	logSourceDebug(fc, "Fetching XMS metrics", "xms", target.Name, "endpoint", endpoint)
 
 	// Make request and show output
-	resp, err := client.Do(req)
+	resp, err := xmsRequest(target, url)
 	if err != nil {
-		logError("Failed to connect", err)
-		setMetricValue("xms_up", 0)
+		logConnectError(fc, "Failed to connect", "err", err)
+		setXmsUp(set, target, endpoint, false)
 		return
 	}
 	defer resp.Body.Close()
@@ -822,53 +1077,66 @@ func fetchXmsMetrics(prefix, url string, user string, pwd string, wg *sync.WaitG
 	var webService WebService
 
 	// parse and decode xml to structure
-	err = xml.NewDecoder(resp.Body).Decode(&webService)
+	err = xml.NewDecoder(debugBody(fc, url, resp.Body)).Decode(&webService)
 
 	if err != nil {
-		logError("Failed to parse response for prefix", prefix, " with error:", err)
-		setMetricValue("xms_up", 0)
+		logSourceError(fc, "Failed to parse response", "xms", target.Name, "endpoint", endpoint, "err", err)
+		setXmsUp(set, target, endpoint, false)
 		return
 	}
 
-	setMetricValue("xms_up", 1)
-	logDebug(fmt.Sprintf("Parsing XMS response body for prefix %s succeeded: %+v", prefix, webService))
+	setXmsUp(set, target, endpoint, true)
+	logSourceDebug(fc, "Parsed XMS response", "xms", target.Name, "endpoint", endpoint, "resources", len(webService.Response.ResourceCounters.Resources)+len(webService.Response.ResourceLicenses.Resources))
 
 	// fetch and set metrics
-	if prefix == "xms_counter" {
-		processXmsResourceCountersMetrics(prefix, webService.Response.ResourceCounters)
+	if endpoint == xmsCounters {
+		processXmsResourceCountersMetrics(fc, "xms_counter", webService.Response.ResourceCounters, xmsAttrs(target))
 	} else {
-		processXmsResourceLicensesMetrics(prefix, webService.Response.ResourceLicenses)
+		processXmsResourceLicensesMetrics(fc, "xms_license", webService.Response.ResourceLicenses, xmsAttrs(target))
 	}
 }
 
-func processXmsResourceCountersMetrics(prefix string, counters ResourceCounters) {
-	//id sent_sip_invites
-	sentSipInvites := counters.Resources[1].Value
-	setMetricValue(prefix+`_sent_sip_invites`, sentSipInvites)
-
-	receivedSipInvites := counters.Resources[2].Value
-	setMetricValue(prefix+`_received_sip_responses`, receivedSipInvites)
-
-	sentSipResponses := counters.Resources[3].Value
-	setMetricValue(prefix+`_sent_sip_responses`, sentSipResponses)
+// processXmsResourceCountersMetrics sets each resource counter by its id, e.g.
+// <resource id="sent_sip_invites" display_name="Sent SIP Invites" value="42"/>
+// as xms_counter_sent_sip_invites with the display name as HELP text
+func processXmsResourceCountersMetrics(fc *fetchContext, prefix string, counters ResourceCounters, attrs []MetricAttribute) {
+	set := fc.set
+	for _, item := range counters.Resources {
+		id := sanitizeMetricName(item.Id)
+		if id == "" {
+			logSourceDebug(fc, "Ignoring XMS resource counter without id", "display_name", item.Display)
+			continue
+		}
+		if item.Display != "" {
+			setMetricHelp(prefix+`_`+id, item.Display)
+		}
+		setMetricValue(set, buildMetricName(prefix, id, attrs), item.Value)
+	}
 }
 
-func processXmsResourceLicensesMetrics(prefix string, licenses ResourceLicenses) {
-
+// processXmsResourceLicensesMetrics sets the figures of each resource license by its
+// id, e.g. xms_license_rtc_total for <resource id="RTC" total="100" .../>
+func processXmsResourceLicensesMetrics(fc *fetchContext, prefix string, licenses ResourceLicenses, attrs []MetricAttribute) {
+	set := fc.set
 	for _, item := range licenses.Resources {
 		//logDebug("fetchXmsMetrics: ", i, "     Id: ", item.Id) //xml
-		prefixplus := prefix + `_` + item.Id + `_`
+		id := sanitizeMetricName(item.Id)
+		if id == "" {
+			logSourceDebug(fc, "Ignoring XMS resource license without id")
+			continue
+		}
+		prefixplus := prefix + `_` + id
 		total, _ := strconv.ParseUint(item.Total, 0, 64)
 		used, _ := strconv.ParseUint(item.Used, 0, 64)
 		free, _ := strconv.ParseUint(item.Free, 0, 64)
 		percUsed, _ := strconv.ParseFloat(item.PercUsed, 64)
 		allocated, _ := strconv.ParseUint(item.Allocated, 0, 64)
 		//logDebug("fetchXmsMetrics: ", prefixplus+`total`,":", total) //xml
-		setMetricValue(prefixplus+`total`, total)
-		setMetricValue(prefixplus+`used`, used)
-		setMetricValue(prefixplus+`free`, free)
-		setMetricValueFloat(prefixplus+`percent_used`, percUsed)
-		setMetricValue(prefixplus+`allocated`, allocated)
+		setMetricValue(set, buildMetricName(prefixplus, `total`, attrs), total)
+		setMetricValue(set, buildMetricName(prefixplus, `used`, attrs), used)
+		setMetricValue(set, buildMetricName(prefixplus, `free`, attrs), free)
+		setMetricValueFloat(set, buildMetricName(prefixplus, `percent_used`, attrs), percUsed)
+		setMetricValue(set, buildMetricName(prefixplus, `allocated`, attrs), allocated)
 	}
 }
 
@@ -882,23 +1150,30 @@ func main() {
 	configFile := flag.String("config", "", "Configuration file to load")
 	flag.BoolVar(&conf.Debug, "debug", false, "Enable debug")
 	flag.StringVar(&conf.ListenAddress, "listen", ":9055", "Listen address")
+	flag.StringVar(&conf.WebConfigFile, "web.config.file", "", "Web config file with TLS and basic authentication settings")
+	flag.StringVar(&conf.LogLevel, "log.level", "", "Log level debug, info, warn or error")
+	flag.StringVar(&conf.LogFormat, "log.format", "", "Log format text or json")
 	flag.Parse()
 
-	if conf.Debug {
-		logInfo("Enabled debug logging")
+	if err := setupLogging(conf); err != nil {
+		logFatal("Unable to configure logging:", err)
 	}
 
 	if configFile != nil && *configFile != "" {
 		logInfo("Loading configuration", *configFile)
 		err := configor.New(&configor.Config{Debug: conf.Debug}).Load(conf, *configFile)
 		if err != nil {
-			log.Fatal("Unable to load configuration", *configFile, err)
+			logFatal("Unable to load configuration", *configFile, err)
 		}
 
 		// Reparse commandline flags to override loaded config parameters
 		flag.Parse()
 	} else {
 		logInfo("No configuration file used. Enabling querying of all C5 and XMS processes.")
+		// Apply the default configuration values like URLs and tiers
+		if err := configor.New(&configor.Config{Debug: conf.Debug}).Load(conf); err != nil {
+			logFatal("Unable to load default configuration", err)
+		}
 		conf.XmsEnabled = true
 		conf.SIPProxydEnabled = true
 		conf.ACDQueuedEnabled = true
@@ -907,67 +1182,48 @@ func main() {
 		conf.CstaEnabled = true
 	}
 
-	if !(conf.SIPProxydEnabled || conf.SIPProxydTrunksEnabled || conf.ACDQueuedEnabled || conf.RegistrardEnabled || conf.NotificationEnabled || conf.CstaEnabled || conf.XmsEnabled || conf.XmsV2Enabled) {
-		logError("No c5 or XMS processes enabled to query. Please enable at least on process in configuration.")
-		log.Fatal("Aborting.")
+	if err := setupLogging(conf); err != nil {
+		logFatal("Unable to configure logging:", err)
+	}
+	if gLogLevel.Level() == slog.LevelDebug {
+		logInfo("Enabled debug logging")
 	}
-	logConfig()
 
-	// Expose the registered metrics at `/metrics` path.
-	http.HandleFunc("/metrics", func(httpResponse http.ResponseWriter, req *http.Request) {
+	pwd, err := resolveSecret(conf.XmsPwd, conf.XmsPwdFile, conf.XmsPwdEnv)
+	if err != nil {
+		logFatal("Unable to load XMS password: ", err)
+	}
+	conf.XmsPwd = pwd
 
-		metricSet = metrics.NewSet()
+	conf.SIPProxydTrunkCallLimits = normalizeTrunkCallLimits(conf.SIPProxydTrunkCallLimits)
+	if conf.HazelcastWorkers < 1 {
+		logWarn("Invalid hazelcastWorkers", conf.HazelcastWorkers, "using 1 worker")
+		conf.HazelcastWorkers = 1
+	}
 
-		var wg sync.WaitGroup
-		// --- XMS5 Metrics
-		if conf.XmsEnabled {
-			wg.Add(2)
-			go fetchXmsMetrics("xms_counter", conf.XmsCountersURL, conf.XmsUser, conf.XmsPwd, &wg)
-			go fetchXmsMetrics("xms_license", conf.XmsLicensesURL, conf.XmsUser, conf.XmsPwd, &wg)
-		}
-		// --- XMS 5.2 (API v2)
-		if conf.XmsV2Enabled {
-			wg.Add(2)
-			go fetchXmsV2Metrics("xms_counter", conf.Xmsv2CountersURL, conf.XmsUser, conf.XmsPwd, &wg)
-			go fetchXmsV2Metrics("xms_license", conf.Xmsv2LicensesURL, conf.XmsUser, conf.XmsPwd, &wg)
-		}
-		// --- C5 Metrics
-		if conf.SIPProxydEnabled {
-			wg.Add(2)
-			go fetchC5StateMetrics("sipproxyd", conf.SIPProxydURL, &wg)
-			go fetchC5HazelcastMetrics("sipproxyd", conf.SIPProxydBaseURL, &wg)
-		}
-		if conf.ACDQueuedEnabled {
-			wg.Add(2)
-			go fetchC5StateMetrics("acdqueued", conf.ACDQueuedURL, &wg)
-			go fetchC5HazelcastMetrics("acdqueued", conf.ACDQueuedBaseURL, &wg)
-		}
-		if conf.RegistrardEnabled {
-			wg.Add(2)
-			go fetchC5StateMetrics("registrard", conf.RegistrardURL, &wg)
-			go fetchC5HazelcastMetrics("registrard", conf.RegistrardBaseURL, &wg)
-		}
-		if conf.NotificationEnabled {
-			wg.Add(2)
-			go fetchC5StateMetrics("notification", conf.NotificationURL, &wg)
-			go fetchC5HazelcastMetrics("notification", conf.NotificationBaseURL, &wg)
-		}
-		if conf.CstaEnabled {
-			wg.Add(1)
-			go fetchC5StateMetrics("cstagwd", conf.CstaURL, &wg)
+	logConfig()
+	if conf.Timezone != "" {
+		loc, err := time.LoadLocation(conf.Timezone)
+		if err != nil {
+			logFatal("Unable to load timezone ", conf.Timezone, ": ", err)
 		}
+		gTimezone = loc
+	}
+	daemons := buildDaemons(conf)
+	counterQueries := buildCounterQueries(conf, daemons)
+	xmsTargets := buildXmsTargets(conf)
 
-		wg.Wait()
-		// We need to ensure sequential processing, so wait between fetches
-		if conf.SIPProxydTrunksEnabled {
-			wg.Add(1)
-			go fetchC5CounterMetrics("sipproxyd", conf.SIPProxydTrunkStatsURL, &wg)
-			wg.Wait()
-			wg.Add(1)
-			go fetchC5CounterMetrics("sipproxyd", conf.SIPProxydTrunkLimitsURL, &wg)
-			wg.Wait()
-		}
-		metricSet.WritePrometheus(httpResponse)
+	if !(len(daemons) > 0 || conf.SIPProxydTrunksEnabled || len(xmsTargets) > 0) {
+		logError("No c5 or XMS processes enabled to query. Please enable at least on process in configuration.")
+		logFatal("Aborting.")
+	}
+
+	c := newCollector(conf, buildSources(conf, daemons, counterQueries, xmsTargets))
+	go c.collectAll()
+
+	// Expose the registered metrics at `/metrics` path.
+	http.HandleFunc("/metrics", func(httpResponse http.ResponseWriter, req *http.Request) {
+		c.writePrometheus(httpResponse, conf.MetricsTiers)
 		if conf.GoCollectorEnabled {
 			metrics.WriteProcessMetrics(httpResponse)
 		}
@@ -976,80 +1232,59 @@ func main() {
 	if conf.SIPProxydExtEnabled {
 		// dedicated endpoint for per-service-provider metrics and BT details
 		http.HandleFunc("/metrics-extended", func(httpResponse http.ResponseWriter, req *http.Request) {
-			metricSet = metrics.NewSet()
-			var wg sync.WaitGroup
-
-			wg.Add(2)
-			go fetchServiceProviderCounters("sipproxyd", conf.SIPProxydSPCountersURL, &wg)
-			go fetchServiceProviderCounters("sipproxyd", conf.SIPProxydClSPCountersURL, &wg)
-
-			wg.Add(1)
-			go fetchC5CounterMetrics("sipproxyd", conf.SIPProxydTrunkStatsURL, &wg)
-			wg.Wait()
-			wg.Add(1)
-			go fetchC5CounterMetrics("sipproxyd", conf.SIPProxydTrunkLimitsURL, &wg)
-			wg.Wait()
-
-			metricSet.WritePrometheus(httpResponse)
+			c.writePrometheus(httpResponse, conf.MetricsExtendedTiers)
 		})
 	}
 
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.HandleFunc("/-/ready", c.readyHandler)
+	http.HandleFunc("/", c.landingHandler(conf))
+	if conf.DebugSourcesEnabled {
+		http.HandleFunc("/debug/sources/", c.debugHandler)
+	}
+
 	// logInfo(fmt.Printf("Starting c5exporter v%s on port %s", version, conf.ListenAddress))
 	logInfo("Starting c5exporter version", version, "on", conf.ListenAddress)
-	log.Fatal(http.ListenAndServe(conf.ListenAddress, nil))
-}
-
-func logInfo(msg ...interface{}) {
-	log.Print("[INFO] ", fmt.Sprintln(msg...))
-}
 
-func logDebug(msg ...interface{}) {
-	if config.AppConfig.Debug {
-		log.Print("[DEBUG] ", fmt.Sprintln(msg...))
+	// Stop on SIGTERM of systemd or Ctrl-C, finishing in-flight scrapes
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go runWatchdog(ctx, c)
+	if err := listenAndServe(ctx, conf, http.DefaultServeMux); err != nil {
+		logFatal(err)
 	}
-}
-
-func logError(msg ...interface{}) {
-	log.Print("[ERROR] ", fmt.Sprintln(msg...))
+	logInfo("Stopped c5exporter")
 }
 
 func logConfig() {
 	conf := config.AppConfig
 	logDebug(fmt.Sprintf("Using configuration: %+v", conf))
-	if conf.SIPProxydEnabled {
-		logInfo("sipproxyd enabled with url", conf.SIPProxydURL)
-	}
 	if conf.SIPProxydExtEnabled {
 		logInfo("sipproxyd extension enabled with url", conf.SIPProxydSPCountersURL)
 	}
-	if conf.ACDQueuedEnabled {
-		logInfo("acdqueued enabled with url", conf.ACDQueuedURL)
-	}
-	if conf.RegistrardEnabled {
-		logInfo("registrard enabled with url", conf.RegistrardURL)
-	}
 	if conf.SIPProxydTrunksEnabled {
 		logInfo("sipproxyd trunks enabled with:")
 		logInfo("- stats url:", conf.SIPProxydTrunkStatsURL)
 		logInfo("- limits url:", conf.SIPProxydTrunkLimitsURL)
-	}
-	if conf.NotificationEnabled {
-		logDebug("notification-server enabled with url:", conf.NotificationURL)
-	}
-	if conf.CstaEnabled {
-		logDebug("cstagwd enabled with url:", conf.CstaURL)
-	}
-	if conf.XmsEnabled {
-		logInfo("xms enabled with user", conf.XmsUser)
-		logInfo("- counters url:", conf.XmsCountersURL)
-		logInfo("- licenses url:", conf.XmsLicensesURL)
-	}
-	if conf.XmsV2Enabled {
-		logInfo("xms v2 enabled with user", conf.XmsUser)
-		logInfo("- counters url:", conf.Xmsv2CountersURL)
-		logInfo("- licenses url:", conf.Xmsv2LicensesURL)
+		if conf.SIPProxydTrunkCallLimitsURL != "" {
+			logInfo("- call limits url:", conf.SIPProxydTrunkCallLimitsURL)
+		}
+		if len(conf.SIPProxydTrunkCallLimits) > 0 {
+			logInfo("- call limits:", conf.SIPProxydTrunkCallLimits)
+		}
+		if conf.SIPProxydTrunkCallLimitsURL == "" && len(conf.SIPProxydTrunkCallLimits) == 0 {
+			logWarn("No sipproxydTrunkCallLimitsURL or sipproxydTrunkCallLimits configured, trunk utilization disabled")
+		}
 	}
 	if conf.GoCollectorEnabled {
 		logDebug("GoCollector and Process metrics enabled")
 	}
+	if conf.ProcessMetricsEnabled {
+		logInfo("C5 process metrics enabled")
+	}
+	logInfo("fast tier refreshed every", conf.FastTierInterval, "and slow tier every", conf.SlowTierInterval)
+	logInfo("- /metrics serving tiers", conf.MetricsTiers)
+	if conf.SIPProxydExtEnabled {
+		logInfo("- /metrics-extended serving tiers", conf.MetricsExtendedTiers)
+	}
 }
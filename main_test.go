@@ -1,73 +1,285 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
 
 const mega = 1024 * 1024
 
-func Test_parseMemoryString(t *testing.T) {
+func Test_parseMemoryUsage(t *testing.T) {
 	tests := []struct {
-		name            string
-		buildString     string
-		wantMemUsed     uint64
-		wantMemTotal    uint64
-		wantMemMaxUsage uint64
+		name        string
+		memoryUsage string
+		want        memoryUsage
+		wantErr     bool
 	}{
-		{"R6.0", "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793", 383 * mega, 2048 * mega, 18},
-		{"R6.2", "C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205", 76 * mega, 2048 * mega, 3},
+		{"R6.0", "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793",
+			memoryUsage{"OK", 18, 383 * mega, 0, 0, 2048 * mega, 18, 60793, true}, false},
+		{"R6.2", "C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205",
+			memoryUsage{"OK", 3, 76 * mega, 76 * mega, 76 * mega, 2048 * mega, 3, 92205, true}, false},
+		{"R6.2 warning", "C5 Heap Health: WARNING  - Mem used: 81%  1659MB  (min: 1500 max: 1700)  - Mem total: 2048MB  - MAX: 83% - UpdCtr: 12",
+			memoryUsage{"WARNING", 81, 1659 * mega, 1500 * mega, 1700 * mega, 2048 * mega, 83, 12, true}, false},
+		{"noUpdCtr", "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18%",
+			memoryUsage{"OK", 18, 383 * mega, 0, 0, 2048 * mega, 18, 0, false}, false},
+		{"invalid", "C5 Heap Health: OK  - Mem used: n/a%  - Mem total: 2048MB  - Max: 18% - UpdCtr: n/a",
+			memoryUsage{"OK", 0, 0, 0, 0, 2048 * mega, 18, 0, false}, true},
+		{"empty", "", memoryUsage{}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotMemUsed, gotMemTotal, gotMemMaxUsage := parseMemoryString(tt.buildString)
-			if gotMemUsed != tt.wantMemUsed {
-				t.Errorf("parseMemoryString() gotMemUsed = %v, want %v", gotMemUsed, tt.wantMemUsed)
+			got, err := parseMemoryUsage(tt.memoryUsage)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMemoryUsage() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if gotMemTotal != tt.wantMemTotal {
-				t.Errorf("parseMemoryString() gotMemTotal = %v, want %v", gotMemTotal, tt.wantMemTotal)
+			if got != tt.want {
+				t.Errorf("parseMemoryUsage() = %+v, want %+v", got, tt.want)
 			}
-			if gotMemMaxUsage != tt.wantMemMaxUsage {
-				t.Errorf("parseMemoryString() gotMemMaxUsage = %v, want %v", gotMemMaxUsage, tt.wantMemMaxUsage)
+		})
+	}
+}
+
+func Test_processMemoryUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		mem  memoryUsage
+		want string
+	}{
+		{"full", memoryUsage{"WARNING", 81, 1659 * mega, 0, 0, 2048 * mega, 83, 12, true}, `c5_memory_health{state="CRITICAL"} 0
+c5_memory_health{state="OK"} 0
+c5_memory_health{state="WARNING"} 1
+c5_memory_max_used_percent 83
+c5_memory_stale 0
+c5_memory_total_bytes 2147483648
+c5_memory_update_counter 12
+c5_memory_used_bytes 1739587584
+c5_memory_used_percent 81
+`},
+		{"noHealthAndUpdCtr", memoryUsage{"", 18, 383 * mega, 0, 0, 2048 * mega, 18, 0, false}, `c5_memory_max_used_percent 18
+c5_memory_total_bytes 2147483648
+c5_memory_used_bytes 401604608
+c5_memory_used_percent 18
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := metrics.NewSet()
+			processMemoryUsage(set, "c5", tt.mem, nil)
+			var buf bytes.Buffer
+			writeMetricSets(&buf, []*metrics.Set{set})
+			if buf.String() != tt.want {
+				t.Errorf("processMemoryUsage() = %q, want %q", buf.String(), tt.want)
 			}
 		})
 	}
 }
 
-func Test_parseMemoryStringRegex(t *testing.T) {
+func Benchmark_parseMemoryUsage(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		parseMemoryUsage("C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793")
+		parseMemoryUsage("C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205")
+	}
+}
+
+func Test_parseTimestamp(t *testing.T) {
+	gTimezone = time.UTC
+	defer func() { gTimezone = time.Local }()
+
 	tests := []struct {
-		name            string
-		buildString     string
-		wantMemUsed     uint64
-		wantMemTotal    uint64
-		wantMemMaxUsage uint64
+		name      string
+		timestamp string
+		want      time.Time
+		wantErr   bool
 	}{
-		{"R6.0", "C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793", 383 * mega, 2048 * mega, 18},
-		{"R6.2", "C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205", 76 * mega, 2048 * mega, 3},
+		{"millis", "2020-01-19 04:01:04.503", time.Date(2020, 1, 19, 4, 1, 4, 503000000, time.UTC), false},
+		{"seconds", "2021-02-25 10:31:48", time.Date(2021, 2, 25, 10, 31, 48, 0, time.UTC), false},
+		{"empty", "", time.Time{}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotMemUsed, gotMemTotal, gotMemMaxUsage := parseMemoryStringRegex(tt.buildString)
-			if gotMemUsed != tt.wantMemUsed {
-				t.Errorf("parseMemoryString() gotMemUsed = %v, want %v", gotMemUsed, tt.wantMemUsed)
+			got, err := parseTimestamp(tt.timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimestamp() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if gotMemTotal != tt.wantMemTotal {
-				t.Errorf("parseMemoryString() gotMemTotal = %v, want %v", gotMemTotal, tt.wantMemTotal)
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimestamp() = %v, want %v", got, tt.want)
 			}
-			if gotMemMaxUsage != tt.wantMemMaxUsage {
-				t.Errorf("parseMemoryString() gotMemMaxUsage = %v, want %v", gotMemMaxUsage, tt.wantMemMaxUsage)
+		})
+	}
+}
+
+func Test_parseClusterInfoDetails(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterInfo string
+		want        clusterInfo
+	}{
+		{"full", "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)", clusterInfo{"1", "Wien", "31", "VAS-1", "8"}},
+		{"noMaster", "DC=2 {Graz} CompGrpId=4 [AS-2]", clusterInfo{"2", "Graz", "4", "AS-2", ""}},
+		{"empty", "", clusterInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseClusterInfoDetails(tt.clusterInfo); got != tt.want {
+				t.Errorf("parseClusterInfoDetails() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Benchmark_parseMemoryString(b *testing.B) {
-	for n := 0; n < b.N; n++ {
-		parseMemoryString("C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793")
-		parseMemoryString("C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205")
+func Test_parseTuQueueStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         string
+		wantState      string
+		wantChecked    uint64
+		wantHasChecked bool
+	}{
+		{"ok", "OK - checked: 1830", "OK", 1830, true},
+		{"blocked", "BLOCKED - checked: 12", "BLOCKED", 12, true},
+		{"stateOnly", "INIT", "INIT", 0, false},
+		{"quoted", `BLOCKED "tu 3" - checked: 7`, `BLOCKED "tu 3"`, 7, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, checked, hasChecked := parseTuQueueStatus(tt.status)
+			if state != tt.wantState || checked != tt.wantChecked || hasChecked != tt.wantHasChecked {
+				t.Errorf("parseTuQueueStatus() = %v, %v, %v, want %v, %v, %v", state, checked, hasChecked, tt.wantState, tt.wantChecked, tt.wantHasChecked)
+			}
+		})
 	}
 }
 
-func Benchmark_parseMemoryStringRegex(b *testing.B) {
-	for n := 0; n < b.N; n++ {
-		parseMemoryStringRegex("C5 Heap Health: OK  - Mem used: 18%  - Mem used: 383MB  - Mem total: 2048MB  - Max: 18% - UpdCtr: 60793")
-		parseMemoryStringRegex("C5 Heap Health: OK  - Mem used: 3%  76MB  (min: 76 max: 76)  - Mem total: 2048MB  - MAX: 3% - UpdCtr: 92205")
+func Test_processTuQueueStatus(t *testing.T) {
+	fc := testFetchContext()
+	processTuQueueStatus(fc, "c5", `BLOCKED "tu 3"`, nil)
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{fc.set})
+	want := `c5_tu_queue_status{state="BLOCKED \"tu 3\""} 1
+`
+	if buf.String() != want {
+		t.Errorf("processTuQueueStatus() = %q, want %q", buf.String(), want)
+	}
+}
+
+func Test_parseBreakdownCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   breakdownCounter
+		wantOk bool
+	}{
+		{"observers", "    OBSERVERS  (dialog,csta,reg):  36,0,0", breakdownCounter{"OBSERVERS", []string{"dialog", "csta", "reg"}, []uint64{36, 0, 0}}, true},
+		{"missingValue", "    OBSERVERS  (dialog,csta,reg):  36,0", breakdownCounter{"OBSERVERS", []string{"dialog", "csta"}, []uint64{36, 0}}, true},
+		{"counter", " 75 PRESENCE_ACTIVE_SUBSCRIPTIONS                       36     36     36     36     36     36", breakdownCounter{}, false},
+		{"subCounter", "                                                      0      0      0      0      1      0", breakdownCounter{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseBreakdownCounter(tt.line)
+			if ok != tt.wantOk || (tt.wantOk && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("parseBreakdownCounter() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_parseResponseTimestamp(t *testing.T) {
+	gTimezone = time.UTC
+	defer func() { gTimezone = time.Local }()
+
+	got, err := parseResponseTimestamp("", "2021-02-25 10:31:48  active")
+	if err != nil || !got.Equal(time.Date(2021, 2, 25, 10, 31, 48, 0, time.UTC)) {
+		t.Errorf("parseResponseTimestamp() = %v, %v", got, err)
+	}
+	if _, err := parseResponseTimestamp("", "active"); err == nil {
+		t.Errorf("parseResponseTimestamp() expected error for missing timestamp")
+	}
+}
+
+func Test_processC5CounterMetricsResponseTimestamp(t *testing.T) {
+	gTimezone = time.UTC
+	defer func() { gTimezone = time.Local }()
+
+	fc := testFetchContext()
+	for _, name := range []string{"BT_ACTIVE_CALLS", "BT_CALLS_LIMIT_REACHED"} {
+		processC5CounterMetrics(fc, "sipproxyd", "trunk", "name", c5CounterResponse{
+			ProxyResponseTimeStampAndState: "2021-02-25 10:31:48  active",
+			CounterName:                    name,
+			CounterType:                    "EVENT",
+		}, nil)
+	}
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{fc.set})
+	out := buf.String()
+	for _, want := range []string{
+		`sipproxyd_response_timestamp_seconds{counter="bt_active_calls"} 1.614249108e+09`,
+		`sipproxyd_response_timestamp_seconds{counter="bt_calls_limit_reached"} 1.614249108e+09`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("processC5CounterMetrics() output does not contain %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sipproxyd_bt_active_calls_response_timestamp_seconds") {
+		t.Errorf("processC5CounterMetrics() exported a response timestamp per counter:\n%s", out)
+	}
+}
+
+func Test_processXmsResourceCountersMetrics(t *testing.T) {
+	body := `<web_service version="1.0"><response><resource_counters>
+<resource id="pending_requests" display_name="Pending Requests" value="0"/>
+<resource id="sent_sip_invites" display_name="Sent SIP Invites" value="42"/>
+<resource id="received_sip_invites" display_name="Received SIP Invites" value="17"/>
+<resource id="" display_name="Invalid" value="1"/>
+</resource_counters></response></web_service>`
+	var webService WebService
+	if err := xml.Unmarshal([]byte(body), &webService); err != nil {
+		t.Fatal(err)
+	}
+	fc := testFetchContext()
+	processXmsResourceCountersMetrics(fc, "xms_counter", webService.Response.ResourceCounters, nil)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{fc.set})
+	want := `# HELP xms_counter_pending_requests Pending Requests
+xms_counter_pending_requests 0
+# HELP xms_counter_received_sip_invites Received SIP Invites
+xms_counter_received_sip_invites 17
+# HELP xms_counter_sent_sip_invites Sent SIP Invites
+xms_counter_sent_sip_invites 42
+`
+	if buf.String() != want {
+		t.Errorf("processXmsResourceCountersMetrics() = %q, want %q", buf.String(), want)
+	}
+}
+
+func Test_processXmsResourceLicensesMetrics(t *testing.T) {
+	body := `<web_service version="1.0"><response><resource_licenses>
+<resource id="RTC" total="100" used="25" free="75" percent_used="25.0" allocated="30"/>
+<resource id="" total="1"/>
+</resource_licenses></response></web_service>`
+	var webService WebService
+	if err := xml.Unmarshal([]byte(body), &webService); err != nil {
+		t.Fatal(err)
+	}
+	fc := testFetchContext()
+	processXmsResourceLicensesMetrics(fc, "xms_license", webService.Response.ResourceLicenses, nil)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{fc.set})
+	want := `xms_license_rtc_allocated 30
+xms_license_rtc_free 75
+xms_license_rtc_percent_used 25
+xms_license_rtc_total 100
+xms_license_rtc_used 25
+`
+	if buf.String() != want {
+		t.Errorf("processXmsResourceLicensesMetrics() = %q, want %q", buf.String(), want)
 	}
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// Linux reports process times in USER_HZ, which is 100 on all supported platforms
+const userHZ = 100
+
+// procStat contains the process figures of a C5 daemon process
+type procStat struct {
+	CPUSeconds    float64
+	ResidentBytes uint64
+	Threads       uint64
+	StartTime     float64 // seconds since epoch
+	OpenFDs       *uint64 // nil if not permitted to read
+	MaxFDs        *uint64 // nil if unlimited or not available
+}
+
+func parseProcStat(stat string, pageSize uint64, bootTime uint64) (ps procStat, err error) {
+	// 17533 (cat) R 17084 17084 17084 0 -1 4194304 82 0 0 0 0 0 0 0 20 0 1 0 40142 2703360 335 ...
+	// The command name may contain spaces and parentheses, so start after the last ')'
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return ps, fmt.Errorf("invalid stat format: %q", stat)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] is field 3 (state) of proc(5)
+	if len(fields) < 22 {
+		return ps, fmt.Errorf("invalid stat format: %q", stat)
+	}
+	// utime, stime, num_threads, starttime and rss
+	var values [5]uint64
+	for i, field := range []int{11, 12, 17, 19, 21} {
+		var ok bool
+		if values[i], ok = tryParseUint64(fields[field]); !ok {
+			return ps, fmt.Errorf("invalid stat field %d: %q", field+3, fields[field])
+		}
+	}
+	ps.CPUSeconds = float64(values[0]+values[1]) / userHZ
+	ps.Threads = values[2]
+	ps.StartTime = float64(bootTime) + float64(values[3])/userHZ
+	ps.ResidentBytes = values[4] * pageSize
+	return
+}
+
+func parseProcBootTime(stat string) (bootTime uint64, err error) {
+	// btime 1792425361
+	for _, line := range strings.Split(stat, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 2 && parts[0] == "btime" {
+			if bootTime, ok := tryParseUint64(parts[1]); ok {
+				return bootTime, nil
+			}
+			return 0, fmt.Errorf("invalid btime: %q", parts[1])
+		}
+	}
+	return 0, fmt.Errorf("btime not found")
+}
+
+func parseProcMaxFDs(limits string) *uint64 {
+	// Max open files            20000                20000                files
+	for _, line := range strings.Split(limits, "\n") {
+		if strings.HasPrefix(line, "Max open files") {
+			parts := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+			if len(parts) > 0 && parts[0] != "unlimited" {
+				if max, ok := tryParseUint64(parts[0]); ok {
+					return &max
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func fetchC5ProcessMetrics(fc *fetchContext, daemon config.DaemonConfig, wg *sync.WaitGroup) {
+	defer wg.Done()
+	set := fc.set
+
+	processName := daemon.ProcessName
+	if processName == "" {
+		processName = daemon.Name
+	}
+	ps, err := readProcess(processName, daemon.PidFile)
+	if err != nil {
+		logSourceDebug(fc, "Failed to read process metrics", "process", daemon.Name, "err", err)
+		return
+	}
+
+	attrs := append(getGlobalAttrs(daemon.Prefix), MetricAttribute{"daemon", daemon.Prefix})
+	setFloatMetricValue(set, buildMetricName("c5_process", "cpu_seconds_total", attrs), ps.CPUSeconds)
+	setMetricValue(set, buildMetricName("c5_process", "resident_memory_bytes", attrs), ps.ResidentBytes)
+	setMetricValue(set, buildMetricName("c5_process", "threads", attrs), ps.Threads)
+	setFloatMetricValue(set, buildMetricName("c5_process", "start_time_seconds", attrs), ps.StartTime)
+	if ps.OpenFDs != nil {
+		setMetricValue(set, buildMetricName("c5_process", "open_fds", attrs), *ps.OpenFDs)
+	}
+	if ps.MaxFDs != nil {
+		setMetricValue(set, buildMetricName("c5_process", "max_fds", attrs), *ps.MaxFDs)
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const procFS = "/proc"
+
+// readProcess reads the figures of the process given by pidFile or, if no
+// pidFile is set, of the first process found with the given name
+func readProcess(name, pidFile string) (ps procStat, err error) {
+	pid, err := findProcess(name, pidFile)
+	if err != nil {
+		return
+	}
+
+	bootStat, err := os.ReadFile(filepath.Join(procFS, "stat"))
+	if err != nil {
+		return
+	}
+	bootTime, err := parseProcBootTime(string(bootStat))
+	if err != nil {
+		return
+	}
+	stat, err := os.ReadFile(filepath.Join(procFS, pid, "stat"))
+	if err != nil {
+		return
+	}
+	ps, err = parseProcStat(string(stat), uint64(os.Getpagesize()), bootTime)
+	if err != nil {
+		return
+	}
+
+	// Reading the file descriptors requires the same user or root privileges
+	if fds, err := os.ReadDir(filepath.Join(procFS, pid, "fd")); err == nil {
+		open := uint64(len(fds))
+		ps.OpenFDs = &open
+	}
+	if limits, err := os.ReadFile(filepath.Join(procFS, pid, "limits")); err == nil {
+		ps.MaxFDs = parseProcMaxFDs(string(limits))
+	}
+	return
+}
+
+func findProcess(name, pidFile string) (string, error) {
+	if pidFile != "" {
+		content, err := os.ReadFile(pidFile)
+		if err != nil {
+			return "", err
+		}
+		pid := strings.TrimSpace(string(content))
+		if _, err := strconv.Atoi(pid); err != nil {
+			return "", fmt.Errorf("invalid pid file %s: %q", pidFile, pid)
+		}
+		return pid, nil
+	}
+
+	entries, err := os.ReadDir(procFS)
+	if err != nil {
+		return "", err
+	}
+	// The kernel truncates the command name to 15 characters
+	comm := name
+	if len(comm) > 15 {
+		comm = comm[:15]
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(procFS, e.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(content)) != comm {
+			continue
+		}
+		if len(name) > 15 {
+			// Verify the full name using the command line
+			cmdline, err := os.ReadFile(filepath.Join(procFS, e.Name(), "cmdline"))
+			if err != nil || filepath.Base(strings.SplitN(string(cmdline), "\x00", 2)[0]) != name {
+				continue
+			}
+		}
+		return e.Name(), nil
+	}
+	return "", fmt.Errorf("process %s not found", name)
+}
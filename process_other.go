@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func readProcess(name, pidFile string) (ps procStat, err error) {
+	return ps, fmt.Errorf("process metrics are only supported on linux")
+}
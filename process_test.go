@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func Test_parseProcStat(t *testing.T) {
+	stat := "17533 (sip proxyd) S 1 17084 17084 0 -1 4194304 82 0 0 0 250 50 0 0 20 0 12 0 40142 2703360 335 18446744073709551615 94602837094400"
+	ps, err := parseProcStat(stat, 4096, 1792425361)
+	if err != nil {
+		t.Fatalf("parseProcStat() error = %v", err)
+	}
+	if ps.CPUSeconds != 3 {
+		t.Errorf("parseProcStat() CPUSeconds = %v, want 3", ps.CPUSeconds)
+	}
+	if ps.Threads != 12 {
+		t.Errorf("parseProcStat() Threads = %v, want 12", ps.Threads)
+	}
+	if ps.StartTime != 1792425361+401.42 {
+		t.Errorf("parseProcStat() StartTime = %v, want %v", ps.StartTime, 1792425361+401.42)
+	}
+	if ps.ResidentBytes != 335*4096 {
+		t.Errorf("parseProcStat() ResidentBytes = %v, want %v", ps.ResidentBytes, 335*4096)
+	}
+	if _, err := parseProcStat("17533 (cat) R 1", 4096, 0); err == nil {
+		t.Errorf("parseProcStat() expected error for truncated stat")
+	}
+	if _, err := parseProcStat("17533 (cat) R 1 17084 17084 0 -1 4194304 82 0 0 0 x 50 0 0 20 0 12 0 40142 2703360 335", 4096, 0); err == nil {
+		t.Errorf("parseProcStat() expected error for invalid utime")
+	}
+}
+
+func Test_parseProcBootTime(t *testing.T) {
+	if bootTime, err := parseProcBootTime("cpu  1 2 3\nbtime 1792425361\nprocesses 42\n"); err != nil || bootTime != 1792425361 {
+		t.Errorf("parseProcBootTime() = %v, %v, want 1792425361", bootTime, err)
+	}
+	if _, err := parseProcBootTime("btime n/a\n"); err == nil {
+		t.Errorf("parseProcBootTime() expected error for invalid btime")
+	}
+}
+
+func Test_parseProcMaxFDs(t *testing.T) {
+	limits := "Limit                     Soft Limit           Hard Limit           Units     \n" +
+		"Max processes             63704                63704                processes \n" +
+		"Max open files            20000                20000                files     \n"
+	if max := parseProcMaxFDs(limits); max == nil || *max != 20000 {
+		t.Errorf("parseProcMaxFDs() = %v, want 20000", max)
+	}
+	if max := parseProcMaxFDs("Max open files            unlimited            unlimited            files"); max != nil {
+		t.Errorf("parseProcMaxFDs() = %v, want nil", *max)
+	}
+	if max := parseProcMaxFDs("Max open files            n/a            n/a            files"); max != nil {
+		t.Errorf("parseProcMaxFDs() = %v, want nil", *max)
+	}
+}
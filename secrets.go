@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// Default credentials of XMS, warned about if still in use
+const (
+	defaultXmsUser = "admin"
+	defaultXmsPwd  = "admin"
+)
+
+// resolveSecret returns the secret from the environment variable env if set, otherwise
+// from file if set, otherwise the configured value. Trailing newlines of the file are ignored.
+func resolveSecret(value config.Secret, file, env string) (config.Secret, error) {
+	if env != "" {
+		if v, ok := os.LookupEnv(env); ok {
+			return config.Secret(v), nil
+		}
+		if file == "" {
+			return "", fmt.Errorf("environment variable %s not set", env)
+		}
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("unable to read password file: %w", err)
+		}
+		return config.Secret(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	return value, nil
+}
+
+func isDefaultXmsCredentials(user string, pwd config.Secret) bool {
+	return user == defaultXmsUser && pwd == defaultXmsPwd
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_resolveSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "xms.pwd")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("C5_EXPORTER_TEST_PWD", "from-env")
+
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		want    config.Secret
+		wantErr bool
+	}{
+		{"value", "", "", "value", false},
+		{"file", file, "", "from-file", false},
+		{"env", "", "C5_EXPORTER_TEST_PWD", "from-env", false},
+		{"env before file", file, "C5_EXPORTER_TEST_PWD", "from-env", false},
+		{"unset env with file", file, "C5_EXPORTER_TEST_UNSET", "from-file", false},
+		{"unset env", "", "C5_EXPORTER_TEST_UNSET", "", true},
+		{"missing file", file + ".missing", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret("value", tt.file, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveSecret() = %q, want %q", string(got), string(tt.want))
+			}
+		})
+	}
+}
+
+func Test_secretRedacted(t *testing.T) {
+	conf := &config.AppConfiguration{XmsUser: "admin", XmsPwd: "topsecret",
+		XmsTargets: []config.XmsTarget{{Name: "media1", Pwd: "othersecret"}}}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		if dump := fmt.Sprintf(format, conf); strings.Contains(dump, "topsecret") || strings.Contains(dump, "othersecret") {
+			t.Errorf("configuration printed with %s reveals secret: %s", format, dump)
+		}
+	}
+}
@@ -3,14 +3,17 @@ package main
 import (
 	"encoding/json"
 	"io"
-	"log"
-	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
 )
 
+var reTableCountInfo = regexp.MustCompile(`:\s*(\d+)\s*\((\d+)\)`)
+var reServiceProviderName = regexp.MustCompile(`serviceProviderName: ([^"]+)`)
+
 func parseServiceProviderCounter(line string, id string) usageCounter {
 /*
 	"name                             current    min    max   lMin   lMax   lAvg      total",
@@ -34,49 +37,95 @@ func parseServiceProviderCounter(line string, id string) usageCounter {
 	}
 }
 
-func fetchServiceProviderCounters(prefix, url string, wg *sync.WaitGroup) {
+func parseTableCountInfo(info string) (count uint64, max uint64, ok bool) {
+	// "tableCountInfo" : "curComponentCount2: 14 (10000) "
+	res := reTableCountInfo.FindStringSubmatch(info)
+	if len(res) < 3 {
+		return 0, 0, false
+	}
+	count, err := strconv.ParseUint(res[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	max, err = strconv.ParseUint(res[2], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return count, max, true
+}
+
+// fetchServiceProviderCounters fetches the service provider counters of the local
+// node (spAll) or the cluster (spAllCl), given by scope "local" or "cluster".
+func fetchServiceProviderCounters(fc *fetchContext, prefix, scope, url string, tlsConf config.TLSConfig, wg *sync.WaitGroup) {
 	defer wg.Done()
-	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get(url)
+	resp, err := httpGet(tlsConf, url)
 	if err != nil {
-		logError("Failed to connect", err)
+		logConnectError(fc, "Failed to connect", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := io.ReadAll(debugBody(fc, url, resp.Body))
 	if err != nil {
-		log.Fatal(err)
+		logSourceError(fc, "Failed to read response", "err", err)
+		return
 	}
-	bodyString := string(bodyBytes)
 
 	var counters map[string]interface{}
-	error := json.Unmarshal([]byte(bodyString), &counters)
-	if error != nil {
-		log.Fatal(error)
+	err = json.Unmarshal(bodyBytes, &counters)
+	if err != nil {
+		logSourceError(fc, "Failed to parse response", "err", err)
+		return
 	}
+	processServiceProviderCounters(fc, prefix, scope, counters)
+}
 
-	re := regexp.MustCompile(`serviceProviderName: ([^"]+)`)
-
-	var clusterInfo = counters["clusterInfo"]
-	if clusterInfo == nil {
-		logError("Failed to get cluster info")
+// processServiceProviderCounters sets the metrics of the spCounterTable entries of a
+// parsed spAll or spAllCl response, entries of an unexpected type are skipped
+func processServiceProviderCounters(fc *fetchContext, prefix, scope string, counters map[string]interface{}) {
+	set := fc.set
+	clusterInfo, isString := counters["clusterInfo"].(string)
+	if !isString {
+		logSourceError(fc, "Failed to get cluster info")
 		return
 	}
-	dc, cmpGrp := parseClusterInfo(clusterInfo.(string))
-	attrs := []MetricAttribute{{"dc", dc}, {"cmpGrp", cmpGrp}}
+	dc, cmpGrp := parseClusterInfo(clusterInfo)
+	attrs := []MetricAttribute{{"dc", dc}, {"cmpGrp", cmpGrp}, {"scope", scope}}
+
+	if info, isString := counters["tableCountInfo"].(string); isString {
+		if count, max, ok := parseTableCountInfo(info); ok {
+			setMetricValue(set, buildMetricName(prefix, "sp_table_count", attrs), count)
+			setMetricValue(set, buildMetricName(prefix, "sp_table_count_max", attrs), max)
+		} else {
+			logSourceError(fc, "Failed to parse table count info", "tableCountInfo", info)
+		}
+	}
 
 	for key, value := range counters {
 		if (strings.HasPrefix(key, "spCounterTable")) {
-			matches := re.FindStringSubmatch(key)
+			matches := reServiceProviderName.FindStringSubmatch(key)
 			if len(matches) > 1 {
 				serviceProvider := matches[1]
 
-				for i := range value.([]interface {}) {
-					line := value.([]interface {})[i].(string)
+				lines, isArray := value.([]interface{})
+				if !isArray {
+					logSourceError(fc, "Unexpected counter table", "sp", serviceProvider)
+					continue
+				}
+				for i := range lines {
+					line, isString := lines[i].(string)
+					if !isString {
+						logSourceError(fc, "Unexpected counter line", "sp", serviceProvider)
+						continue
+					}
 					if (!strings.HasPrefix(line, "name")) {
 						ctr := parseServiceProviderCounter(line, serviceProvider)
-						setUsageMetric(prefix, ctr, append(attrs, MetricAttribute{"sp", serviceProvider}))
+						if ctr.Name == "" {
+							continue
+						}
+						spAttrs := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"sp", serviceProvider})
+						setUsageMetric(set, prefix, ctr, spAttrs)
+						setMetricValue(set, buildMetricName(prefix, ctr.Name+"_total", spAttrs), ctr.Total)
 					}
 				}
 			}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_parseTableCountInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      string
+		wantCount uint64
+		wantMax   uint64
+		wantOk    bool
+	}{
+		{"count", "curComponentCount2: 14 (10000) ", 14, 10000, true},
+		{"empty", "", 0, 0, false},
+		{"overflow", "curComponentCount2: 14 (100000000000000000000000000) ", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, max, ok := parseTableCountInfo(tt.info)
+			if count != tt.wantCount || max != tt.wantMax || ok != tt.wantOk {
+				t.Errorf("parseTableCountInfo() = %v, %v, %v, want %v, %v, %v", count, max, ok, tt.wantCount, tt.wantMax, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_processServiceProviderCounters(t *testing.T) {
+	line := "BT_ACTIVE_CALLS                       3      0      5      0      0      0         42"
+	tests := []struct {
+		name     string
+		counters map[string]interface{}
+		want     int
+	}{
+		{"valid", map[string]interface{}{
+			"clusterInfo": "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)",
+			"spCounterTable serviceProviderName: sp1": []interface{}{"name current min max lMin lMax lAvg total", line},
+		}, 1},
+		{"missing cluster info", map[string]interface{}{
+			"spCounterTable serviceProviderName: sp1": []interface{}{line},
+		}, 0},
+		{"cluster info not a string", map[string]interface{}{
+			"clusterInfo": 42.0,
+			"spCounterTable serviceProviderName: sp1": []interface{}{line},
+		}, 0},
+		{"table not an array", map[string]interface{}{
+			"clusterInfo": "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)",
+			"spCounterTable serviceProviderName: sp1": line,
+		}, 0},
+		{"line not a string", map[string]interface{}{
+			"clusterInfo": "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)",
+			"spCounterTable serviceProviderName: sp1": []interface{}{42.0, line},
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := testFetchContext()
+			processServiceProviderCounters(fc, "sipproxyd", "local", tt.counters)
+			var buf bytes.Buffer
+			fc.set.WritePrometheus(&buf)
+			if got := strings.Count(buf.String(), `sipproxyd_bt_active_calls_total{`); got != tt.want {
+				t.Errorf("processServiceProviderCounters() exported %d total series, want %d:\n%s", got, tt.want, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// State kept across scrapes to detect restarts of the C5 daemons and
+// counters which stopped increasing
+var gStartTimes map[string]time.Time
+var gRestarts map[string]uint64
+var gLastChanges map[string]lastChange
+var stateMtx sync.Mutex
+
+type lastChange struct {
+	value uint64
+	time  time.Time
+}
+
+// unchangedSince remembers the value for key and returns the time of its last change,
+// which is now for new keys. Scrapes within one C5 update period therefore do not
+// report a counter as stopped, only the time it was not changing.
+func unchangedSince(key string, value uint64, now time.Time) time.Time {
+	stateMtx.Lock()
+	defer stateMtx.Unlock()
+
+	if gLastChanges == nil {
+		gLastChanges = make(map[string]lastChange)
+	}
+	last, known := gLastChanges[key]
+	if !known || last.value != value {
+		last = lastChange{value, now}
+		gLastChanges[key] = last
+	}
+	return last.time
+}
+
+// trackRestarts remembers the start time of a daemon and returns the number of
+// restarts detected since the exporter was started
+func trackRestarts(prefix string, startTime time.Time) (restarts uint64, restarted bool) {
+	stateMtx.Lock()
+	defer stateMtx.Unlock()
+
+	if gStartTimes == nil {
+		gStartTimes = make(map[string]time.Time)
+		gRestarts = make(map[string]uint64)
+	}
+	last, known := gStartTimes[prefix]
+	if known && startTime.After(last) {
+		gRestarts[prefix]++
+		restarted = true
+	}
+	if !known || restarted {
+		gStartTimes[prefix] = startTime
+	}
+	return gRestarts[prefix], restarted
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_trackRestarts(t *testing.T) {
+	start := time.Date(2020, 1, 19, 4, 1, 4, 0, time.UTC)
+	steps := []struct {
+		startTime     time.Time
+		wantRestarts  uint64
+		wantRestarted bool
+	}{
+		{start, 0, false},
+		{start, 0, false},
+		{start.Add(time.Hour), 1, true},
+		{start, 1, false}, // outdated response of another node
+		{start.Add(2 * time.Hour), 2, true},
+	}
+	for i, s := range steps {
+		restarts, restarted := trackRestarts("test_restarts", s.startTime)
+		if restarts != s.wantRestarts || restarted != s.wantRestarted {
+			t.Errorf("trackRestarts() step %d = %v, %v, want %v, %v", i, restarts, restarted, s.wantRestarts, s.wantRestarted)
+		}
+	}
+}
+
+func Test_unchangedSince(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	steps := []struct {
+		value uint64
+		now   time.Time
+		want  time.Time
+	}{
+		{100, start, start},
+		{100, start.Add(time.Second), start}, // scrape within one C5 update period
+		{100, start.Add(time.Minute), start},
+		{101, start.Add(2 * time.Minute), start.Add(2 * time.Minute)},
+		{101, start.Add(10 * time.Minute), start.Add(2 * time.Minute)},
+	}
+	for i, s := range steps {
+		if got := unchangedSince("test_unchanged", s.value, s.now); !got.Equal(s.want) {
+			t.Errorf("unchangedSince() step %d = %v, want %v", i, got, s.want)
+		}
+	}
+}
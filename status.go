@@ -0,0 +1,109 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// sourceInfo is the status of a source shown on the landing page
+type sourceInfo struct {
+	Name   string
+	Tier   string
+	URL    string
+	Status string // ok, error or never if not polled yet
+	sourceStatus
+}
+
+func (c *collector) sourceInfos() (infos []sourceInfo) {
+	for _, s := range c.sources {
+		st := s.lastStatus()
+		status := "never"
+		if st.ok() {
+			status = "ok"
+		} else if st.polled() {
+			status = "error"
+		}
+		infos = append(infos, sourceInfo{s.name, s.tier, s.url, status, st})
+	}
+	return
+}
+
+// ready reports whether at least one source was reachable on its last poll
+func (c *collector) ready() bool {
+	for _, s := range c.sources {
+		if s.lastStatus().ok() {
+			return true
+		}
+	}
+	return false
+}
+
+func healthyHandler(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("OK\n"))
+}
+
+func (c *collector) readyHandler(w http.ResponseWriter, req *http.Request) {
+	if !c.ready() {
+		http.Error(w, "No source reachable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK\n"))
+}
+
+var landingTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>C5 Exporter</title></head>
+<body>
+<h1>C5 Exporter</h1>
+<p>Version {{.Version}}</p>
+<ul>
+<li><a href="metrics">Metrics</a></li>
+{{- if .Extended}}
+<li><a href="metrics-extended">Extended metrics</a></li>
+{{- end}}
+<li><a href="-/healthy">Health</a></li>
+<li><a href="-/ready">Readiness</a></li>
+</ul>
+<h2>Sources</h2>
+<table border="1" cellpadding="4">
+<tr><th>Name</th><th>Tier</th><th>URL</th><th>Status</th><th>Last scrape</th><th>Duration</th><th>Errors</th></tr>
+{{- range .Sources}}
+<tr>
+<td>{{if $.Debug}}<a href="debug/sources/{{.Name}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{.Tier}}</td>
+<td>{{.URL}}</td>
+<td>{{.Status}}</td>
+<td>{{if .Refreshed.IsZero}}-{{else}}{{.Refreshed.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{if .Refreshed.IsZero}}-{{else}}{{duration .Duration}}{{end}}</td>
+<td>{{range .Errors}}{{.}}<br>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// landingHandler serves the landing page listing the sources and their last scrape
+func (c *collector) landingHandler(conf *config.AppConfiguration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		data := struct {
+			Version  string
+			Extended bool
+			Debug    bool
+			Sources  []sourceInfo
+		}{version, conf.SIPProxydExtEnabled, conf.DebugSourcesEnabled, c.sourceInfos()}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, data); err != nil {
+			logError("Failed to render landing page", err)
+		}
+	}
+}
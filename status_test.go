@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func testSource(name string, fail bool) *source {
+	return &source{name: name, tier: tierFast, url: "http://" + name, fetch: func(fc *fetchContext, wg *sync.WaitGroup) {
+		defer wg.Done()
+		if fail {
+			logSourceError(fc, "Failed to connect", "err", "connection refused")
+			return
+		}
+		setMetricValue(fc.set, name+"_up", 1)
+	}}
+}
+
+func testCollector(sources ...*source) *collector {
+	return &collector{sources: sources, intervals: map[string]time.Duration{tierFast: 0, tierSlow: 0}}
+}
+
+func Test_collectorReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []*source
+		want    int
+	}{
+		{"no sources", nil, http.StatusServiceUnavailable},
+		{"all failed", []*source{testSource("a", true), testSource("b", true)}, http.StatusServiceUnavailable},
+		{"one reachable", []*source{testSource("a", true), testSource("b", false)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCollector(tt.sources...)
+			rec := httptest.NewRecorder()
+			c.readyHandler(rec, httptest.NewRequest("GET", "/-/ready", nil))
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("readyHandler() status before collect = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+			}
+
+			c.collectAll()
+			rec = httptest.NewRecorder()
+			c.readyHandler(rec, httptest.NewRequest("GET", "/-/ready", nil))
+			if rec.Code != tt.want {
+				t.Errorf("readyHandler() status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sourceStatus(t *testing.T) {
+	s := testSource("a", true)
+	if st := s.lastStatus(); st.polled() {
+		t.Errorf("lastStatus() polled before refresh")
+	}
+	s.refresh(0)
+	st := s.lastStatus()
+	if !st.polled() || st.ok() {
+		t.Errorf("lastStatus() = %+v, want polled with errors", st)
+	}
+	if len(st.Errors) != 1 || st.Errors[0] != "Failed to connect err=connection refused" {
+		t.Errorf("lastStatus().Errors = %q, want [Failed to connect err=connection refused]", st.Errors)
+	}
+	s.refresh(0)
+	if st := s.lastStatus(); len(st.Errors) != 1 {
+		t.Errorf("lastStatus().Errors = %q after second refresh, want only the last errors", st.Errors)
+	}
+}
+
+func Test_landingHandler(t *testing.T) {
+	c := testCollector(testSource("sipproxyd", false), testSource("xms_<counters>", true))
+	c.collect([]string{tierFast})
+
+	rec := httptest.NewRecorder()
+	c.landingHandler(&config.AppConfiguration{})(rec, httptest.NewRequest("GET", "/", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"Version " + version, "http://sipproxyd", "<td>ok</td>", "<td>error</td>",
+		"xms_&lt;counters&gt;", "Failed to connect err=connection refused"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("landingHandler() body does not contain %q", want)
+		}
+	}
+	if strings.Contains(body, "metrics-extended") {
+		t.Errorf("landingHandler() links metrics-extended although disabled")
+	}
+
+	rec = httptest.NewRecorder()
+	c.landingHandler(&config.AppConfiguration{})(rec, httptest.NewRequest("GET", "/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("landingHandler() status of unknown path = %d, want 404", rec.Code)
+	}
+}
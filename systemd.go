@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States sent to systemd, see sd_notify(3)
+const (
+	sdReady    = "READY=1"
+	sdStopping = "STOPPING=1"
+	sdWatchdog = "WATCHDOG=1"
+)
+
+// sdNotify sends a state to the notification socket of systemd given by NOTIFY_SOCKET,
+// nothing is sent if the exporter is not started by a unit of Type=notify
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		// Abstract socket namespace
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the interval to notify the systemd watchdog configured
+// with WatchdogSec, which is half of the watchdog timeout as recommended by
+// sd_watchdog_enabled(3), or 0 if the watchdog is disabled
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// runWatchdog notifies the systemd watchdog until ctx is cancelled as long as the
+// collector is alive
+func runWatchdog(ctx context.Context, c *collector) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logInfo("Notifying systemd watchdog every", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// A collect running for half of the watchdog timeout is considered hung
+			if started, alive := checkAlive(c, now, interval); !alive {
+				logWarn("Skipping systemd watchdog notification, collect running since", started)
+				continue
+			}
+			if err := sdNotify(sdWatchdog); err != nil {
+				logWarn("Failed to notify systemd watchdog:", err)
+			}
+		}
+	}
+}
+
+// checkAlive reports whether no collect has been running for maxDuration or longer,
+// returning the start time of the longest running collect. The collector is checked
+// without fetching the sources, an idle collector is alive.
+func checkAlive(c *collector, now time.Time, maxDuration time.Duration) (started time.Time, alive bool) {
+	started, running := c.oldestCollect()
+	return started, !running || now.Sub(started) < maxDuration
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_sdNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	if err := sdNotify(sdReady); err != nil {
+		t.Fatalf("sdNotify() error = %v", err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != sdReady {
+		t.Errorf("sdNotify() sent %q, want %q", got, sdReady)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify(sdReady); err != nil {
+		t.Errorf("sdNotify() without NOTIFY_SOCKET error = %v, want nil", err)
+	}
+}
+
+func Test_watchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"disabled", "", "", 0},
+		{"invalid", "abc", "", 0},
+		{"enabled", "30000000", "", 15 * time.Second},
+		{"own pid", "30000000", strconv.Itoa(os.Getpid()), 15 * time.Second},
+		{"other pid", "30000000", "1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := watchdogInterval(); got != tt.want {
+				t.Errorf("watchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkAlive(t *testing.T) {
+	interval := 10 * time.Second
+	c := testCollector(testSource("a", false))
+
+	if _, alive := checkAlive(c, time.Now().Add(10*interval), interval); !alive {
+		t.Errorf("checkAlive() = false for an idle collector, want true")
+	}
+	done := c.startCollect()
+	started, _ := c.oldestCollect()
+	if _, alive := checkAlive(c, started.Add(interval/2), interval); !alive {
+		t.Errorf("checkAlive() = false for a collect running for half the interval, want true")
+	}
+	second := c.startCollect()
+	if got, alive := checkAlive(c, started.Add(interval), interval); alive || !got.Equal(started) {
+		t.Errorf("checkAlive() = %v, %v for a collect running for the interval, want %v, false", got, alive, started)
+	}
+	done()
+	second()
+	if _, alive := checkAlive(c, started.Add(interval), interval); !alive {
+		t.Errorf("checkAlive() = false after the collects completed, want true")
+	}
+}
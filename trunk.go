@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func parseTrunkLimit(line string) (name string, limit uint64, ok bool) {
+	// "name                                limit",
+	// "trunkname1.ipcentrex.internal          30",
+	parts := strings.Fields(line)
+	if len(parts) < 2 || parts[0] == "name" {
+		return "", 0, false
+	}
+	limit, err := strconv.ParseUint(parts[len(parts)-1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return normalizeMetricName(parts[0]), limit, true
+}
+
+// normalizeTrunkCallLimits normalizes the trunk names of the configured call limits
+// like the row names of the C5 trunk tables
+func normalizeTrunkCallLimits(limits map[string]uint64) map[string]uint64 {
+	normalized := make(map[string]uint64, len(limits))
+	for name, limit := range limits {
+		normalized[normalizeMetricName(name)] = limit
+	}
+	return normalized
+}
+
+// fetchC5TrunkCallLimits fetches the configured call limit of each business trunk
+// from the sessionconsole command given by url
+//
+//	{
+//	  "clusterInfo" : "DC=1 {Wien} CompGrpId=31 [VAS-1] (masterId=8)",
+//	  "tableValues" : [
+//	    "name                                limit",
+//	    "trunkname1.ipcentrex.internal          30",
+//	    "trunk2.otherprovider.at               120",
+//	  ]
+//	}
+func fetchC5TrunkCallLimits(fc *fetchContext, url string, tlsConf config.TLSConfig) (limits map[string]uint64, ok bool) {
+	resp, err := httpGet(tlsConf, url)
+	if err != nil {
+		logConnectError(fc, "Failed to fetch trunk call limits", "err", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	var c5Resp c5CounterResponse
+	if err := json.NewDecoder(debugBody(fc, url, resp.Body)).Decode(&c5Resp); err != nil {
+		logSourceError(fc, "Failed to parse trunk call limits", "err", err)
+		return nil, false
+	}
+	limits = make(map[string]uint64)
+	for _, line := range c5Resp.TableValues {
+		l, isString := line.(string)
+		if !isString {
+			continue
+		}
+		if name, limit, valid := parseTrunkLimit(l); valid {
+			limits[name] = limit
+			debugParsedLine(fc, debugTable, l, "")
+		} else {
+			debugParsedLine(fc, debugIgnored, l, "no trunk name and limit")
+		}
+	}
+	return limits, true
+}
+
+// processTrunkUtilization exports the configured call limit and the ratio of active
+// calls to the limit of each business trunk
+func processTrunkUtilization(set *metrics.Set, prefix string, active, limits map[string]uint64, attrs []MetricAttribute) {
+	for name, limit := range limits {
+		tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{"name", name})
+		setMetricValue(set, buildMetricName(prefix, "trunk_limit_calls", tmp), limit)
+		if limit == 0 {
+			// No limit configured for this trunk
+			continue
+		}
+		setFloatMetricValue(set, buildMetricName(prefix, "trunk_utilization_ratio", tmp), float64(active[name])/float64(limit))
+	}
+}
+
+// fetchC5TrunkMetrics fetches the trunk statistics, limit counters and call limits and
+// combines the active calls with the call limit of each business trunk to the trunk
+// utilization. Call limits fetched from C5 are overridden by the configured limits.
+// The utilization is skipped if the active calls could not be fetched.
+func fetchC5TrunkMetrics(fc *fetchContext, conf *config.AppConfiguration, wg *sync.WaitGroup) {
+	defer wg.Done()
+	set := fc.set
+
+	// C5 counter queries must not be processed in parallel
+	active, ok := fetchC5CounterTable(fc, "sipproxyd", "trunk", "name", conf.SIPProxydTrunkStatsURL, conf.C5TLS)
+	fetchC5CounterTable(fc, "sipproxyd", "trunk", "name", conf.SIPProxydTrunkLimitsURL, conf.C5TLS)
+	limits := make(map[string]uint64)
+	if conf.SIPProxydTrunkCallLimitsURL != "" {
+		fetched, _ := fetchC5TrunkCallLimits(fc, conf.SIPProxydTrunkCallLimitsURL, conf.C5TLS)
+		for name, limit := range fetched {
+			limits[name] = limit
+		}
+	}
+	for name, limit := range conf.SIPProxydTrunkCallLimits {
+		limits[name] = limit
+	}
+	if !ok {
+		logSourceDebug(fc, "Skipping trunk utilization without active calls")
+		return
+	}
+	processTrunkUtilization(set, "sipproxyd", active, limits, getGlobalAttrs("sipproxyd"))
+}
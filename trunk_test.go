@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_parseTrunkLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantName  string
+		wantLimit uint64
+		wantOk    bool
+	}{
+		{"limit", "trunkname1.ipcentrex.internal.          30", "trunkname1.ipcentrex.internal", 30, true},
+		{"header", "name                                limit", "", 0, false},
+		{"invalid limit", "trunk1 unlimited", "", 0, false},
+		{"missing limit", "trunk1", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, limit, ok := parseTrunkLimit(tt.line)
+			if name != tt.wantName || limit != tt.wantLimit || ok != tt.wantOk {
+				t.Errorf("parseTrunkLimit() = %q, %v, %v, want %q, %v, %v", name, limit, ok, tt.wantName, tt.wantLimit, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_normalizeTrunkCallLimits(t *testing.T) {
+	got := normalizeTrunkCallLimits(map[string]uint64{"trunk1.ipcentrex.internal. ": 30})
+	if len(got) != 1 || got["trunk1.ipcentrex.internal"] != 30 {
+		t.Errorf("normalizeTrunkCallLimits() = %v, want map[trunk1.ipcentrex.internal:30]", got)
+	}
+}
+
+func Test_processTrunkUtilization(t *testing.T) {
+	set := metrics.NewSet()
+	active := map[string]uint64{"trunk1": 15, "trunk2": 3}
+	limits := map[string]uint64{"trunk1": 30, "trunk3": 0}
+	processTrunkUtilization(set, "sipproxyd", active, limits, nil)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{set})
+	want := `sipproxyd_trunk_limit_calls{name="trunk1"} 30
+sipproxyd_trunk_limit_calls{name="trunk3"} 0
+sipproxyd_trunk_utilization_ratio{name="trunk1"} 0.5
+`
+	if buf.String() != want {
+		t.Errorf("processTrunkUtilization() = %q, want %q", buf.String(), want)
+	}
+}
+
+func Test_fetchC5TrunkMetrics(t *testing.T) {
+	statsOk := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RawQuery {
+		case "3&7&309":
+			if !statsOk {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"counterName": "BT_ACTIVE_CALLS", "counterType": "USAGE", "tableValues": [
+				"name                                current    min    max   lMin   lMax   lAvg",
+				"trunk1.ipcentrex.internal                15      0     20      0     20     10",
+				"trunk2.otherprovider.at                   3      0      5      0      5      2"]}`))
+		case "3&7&368":
+			w.Write([]byte(`{"counterName": "BT_CALLS_LIMIT_REACHED", "counterType": "EVENT", "tableValues": []}`))
+		case "limits":
+			w.Write([]byte(`{"tableValues": ["name   limit", "trunk1.ipcentrex.internal   30", "trunk2.otherprovider.at   12"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conf := &config.AppConfiguration{
+		SIPProxydTrunkStatsURL:      srv.URL + "?3&7&309",
+		SIPProxydTrunkLimitsURL:     srv.URL + "?3&7&368",
+		SIPProxydTrunkCallLimitsURL: srv.URL + "?limits",
+		SIPProxydTrunkCallLimits:    map[string]uint64{"trunk2.otherprovider.at": 6},
+	}
+	fetch := func() string {
+		fc := testFetchContext()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		fetchC5TrunkMetrics(fc, conf, &wg)
+		var buf bytes.Buffer
+		writeMetricSets(&buf, []*metrics.Set{fc.set})
+		return buf.String()
+	}
+
+	out := fetch()
+	for _, want := range []string{
+		`sipproxyd_trunk_limit_calls{name="trunk1.ipcentrex.internal"} 30`,
+		`sipproxyd_trunk_utilization_ratio{name="trunk1.ipcentrex.internal"} 0.5`,
+		`sipproxyd_trunk_limit_calls{name="trunk2.otherprovider.at"} 6`,
+		`sipproxyd_trunk_utilization_ratio{name="trunk2.otherprovider.at"} 0.5`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("fetchC5TrunkMetrics() output does not contain %s:\n%s", want, out)
+		}
+	}
+
+	statsOk = false
+	if out := fetch(); strings.Contains(out, "trunk_utilization_ratio") {
+		t.Errorf("fetchC5TrunkMetrics() exported the utilization without active calls:\n%s", out)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// webConfig is the TLS and basic authentication configuration of the exporter's own
+// listener, using the web config file format of the Prometheus exporter-toolkit
+//
+//	tls_server_config:
+//	  cert_file: /etc/prometheus-c5-exporter/exporter.pem
+//	  key_file: /etc/prometheus-c5-exporter/exporter.key
+//	  min_version: TLS12
+//	  client_ca_file: /etc/prometheus-c5-exporter/prometheus-ca.pem
+//	basic_auth_users:
+//	  prometheus: $2y$10$...
+type webConfig struct {
+	TLSServerConfig webTLSConfig             `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]config.Secret `yaml:"basic_auth_users"` // bcrypt hashed passwords by user
+}
+
+type webTLSConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+	MinVersion     string `yaml:"min_version"`
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// loadWebConfig reads the web config file, unknown keys are rejected to detect typos
+func loadWebConfig(file string) (*webConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wc := &webConfig{}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(wc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to parse %s: %w", file, err)
+	}
+	for user, hash := range wc.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash of user %s: %w", user, err)
+		}
+	}
+	return wc, nil
+}
+
+func (wc *webConfig) tlsEnabled() bool {
+	return wc.TLSServerConfig.CertFile != "" || wc.TLSServerConfig.KeyFile != ""
+}
+
+// serverTLSConfig creates the TLS configuration of the listener, the minimum version
+// defaults to TLS 1.2 and client certificates are verified if a client CA is configured
+func (wc *webConfig) serverTLSConfig() (*tls.Config, error) {
+	c := wc.TLSServerConfig
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("both cert_file and key_file are required for TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %s", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if c.ClientCAFile != "" {
+		ca, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.ClientAuthType != "" {
+		authType, ok := clientAuthTypes[c.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth_type %s", c.ClientAuthType)
+		}
+		if authType >= tls.VerifyClientCertIfGiven && tlsConfig.ClientCAs == nil {
+			return nil, fmt.Errorf("client_auth_type %s requires client_ca_file", c.ClientAuthType)
+		}
+		tlsConfig.ClientAuth = authType
+	}
+	return tlsConfig, nil
+}
+
+// basicAuth requires the credentials of one of the configured users. Successful
+// verifications are cached as bcrypt is expensive by design.
+type basicAuth struct {
+	users   map[string]config.Secret
+	handler http.Handler
+
+	mtx   sync.Mutex
+	valid map[[32]byte]bool
+}
+
+// Hash compared for unknown users to not reveal existing users by the response time
+var unknownUserHash []byte
+var unknownUserOnce sync.Once
+
+func (a *basicAuth) authenticate(user, pwd string) bool {
+	key := sha256.Sum256([]byte(user + "\x00" + pwd))
+	a.mtx.Lock()
+	valid := a.valid[key]
+	a.mtx.Unlock()
+	if valid {
+		return true
+	}
+
+	hash, known := a.users[user]
+	if !known {
+		unknownUserOnce.Do(func() {
+			unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(pwd))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd)) != nil {
+		return false
+	}
+	a.mtx.Lock()
+	if a.valid == nil {
+		a.valid = make(map[[32]byte]bool)
+	}
+	a.valid[key] = true
+	a.mtx.Unlock()
+	return true
+}
+
+type authUserKey struct{}
+
+func (a *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pwd, ok := r.BasicAuth()
+	if !ok || !a.authenticate(user, pwd) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="prometheus-c5-exporter"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	a.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)))
+}
+
+// authenticatedUser returns the user of a request verified by basic authentication
+func authenticatedUser(r *http.Request) (string, bool) {
+	user, ok := r.Context().Value(authUserKey{}).(string)
+	return user, ok
+}
+
+const readHeaderTimeout = 10 * time.Second
+
+// newServer creates the server of the listen address using the TLS and basic
+// authentication settings of the web config file if configured
+func newServer(conf *config.AppConfiguration, handler http.Handler) (*http.Server, error) {
+	// Limit the time to read the request headers, slow clients would hold connections forever
+	server := &http.Server{Addr: conf.ListenAddress, Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+	if conf.WebConfigFile == "" {
+		return server, nil
+	}
+
+	wc, err := loadWebConfig(conf.WebConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(wc.BasicAuthUsers) > 0 {
+		server.Handler = &basicAuth{users: wc.BasicAuthUsers, handler: handler}
+		logInfo("Basic authentication enabled for", len(wc.BasicAuthUsers), "users")
+		if !wc.tlsEnabled() {
+			logWarn("Basic authentication without TLS sends the passwords in clear text")
+		}
+	}
+	if !wc.tlsEnabled() {
+		return server, nil
+	}
+	server.TLSConfig, err = wc.serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	logInfo("TLS enabled with certificate", wc.TLSServerConfig.CertFile)
+	return server, nil
+}
+
+// listenAndServe serves handler on the listen address until ctx is cancelled and
+// shuts the server down gracefully
+func listenAndServe(ctx context.Context, conf *config.AppConfiguration, handler http.Handler) error {
+	server, err := newServer(conf, handler)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", conf.ListenAddress)
+	if err != nil {
+		return err
+	}
+	return serve(ctx, server, ln, conf.DrainTimeout)
+}
+
+// serve serves requests on ln and notifies systemd once the exporter is ready. When
+// ctx is cancelled, in-flight requests are drained for up to drainTimeout before the
+// remaining connections are closed.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, drainTimeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errc <- server.ServeTLS(ln, "", "")
+		} else {
+			errc <- server.Serve(ln)
+		}
+	}()
+	if err := sdNotify(sdReady); err != nil {
+		logWarn("Failed to notify systemd:", err)
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	logInfo("Shutting down, draining in-flight requests for up to", drainTimeout)
+	if err := sdNotify(sdStopping); err != nil {
+		logWarn("Failed to notify systemd:", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logWarn("Closing connections of requests not finished within", drainTimeout)
+		return server.Close()
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/communi5/prometheus-c5-exporter/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_loadWebConfig(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"tls and users", "tls_server_config:\n  cert_file: exporter.pem\n  key_file: exporter.key\n  min_version: TLS13\nbasic_auth_users:\n  prometheus: " + string(hash) + "\n", false},
+		{"unknown key", "tls_config:\n  cert_file: exporter.pem\n", true},
+		{"plain password", "basic_auth_users:\n  prometheus: secret\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "web-config.yml")
+			if err := os.WriteFile(file, []byte(tt.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadWebConfig(file); (err != nil) != tt.wantErr {
+				t.Errorf("loadWebConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and its key
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func Test_serverTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+
+	tests := []struct {
+		name           string
+		tls            webTLSConfig
+		wantMinVersion uint16
+		wantClientAuth tls.ClientAuthType
+		wantErr        bool
+	}{
+		{"defaults", webTLSConfig{CertFile: certFile, KeyFile: keyFile}, tls.VersionTLS12, tls.NoClientCert, false},
+		{"min version", webTLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "TLS13"}, tls.VersionTLS13, tls.NoClientCert, false},
+		{"client ca", webTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}, tls.VersionTLS12, tls.RequireAndVerifyClientCert, false},
+		{"client auth type", webTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuthType: "VerifyClientCertIfGiven"}, tls.VersionTLS12, tls.VerifyClientCertIfGiven, false},
+		{"client auth without ca", webTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuthType: "RequireAndVerifyClientCert"}, 0, 0, true},
+		{"unknown version", webTLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "SSL3"}, 0, 0, true},
+		{"missing key", webTLSConfig{CertFile: certFile}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wc := &webConfig{TLSServerConfig: tt.tls}
+			got, err := wc.serverTLSConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("serverTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.MinVersion != tt.wantMinVersion || got.ClientAuth != tt.wantClientAuth) {
+				t.Errorf("serverTLSConfig() = min version %x, client auth %v, want %x, %v", got.MinVersion, got.ClientAuth, tt.wantMinVersion, tt.wantClientAuth)
+			}
+		})
+	}
+}
+
+func Test_basicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &basicAuth{users: map[string]config.Secret{"prometheus": config.Secret(hash)},
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+
+	tests := []struct {
+		name       string
+		user, pwd  string
+		noAuth     bool
+		wantStatus int
+	}{
+		{"valid", "prometheus", "secret", false, http.StatusOK},
+		{"valid cached", "prometheus", "secret", false, http.StatusOK},
+		{"wrong password", "prometheus", "wrong", false, http.StatusUnauthorized},
+		{"unknown user", "other", "secret", false, http.StatusUnauthorized},
+		{"no credentials", "", "", true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.user, tt.pwd)
+			}
+			rec := httptest.NewRecorder()
+			auth.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("basicAuth.ServeHTTP() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_serveDrain(t *testing.T) {
+	tests := []struct {
+		name         string
+		delay        time.Duration
+		drainTimeout time.Duration
+		wantErr      bool
+	}{
+		{"drained", 100 * time.Millisecond, 2 * time.Second, false},
+		{"drain timeout", 2 * time.Second, 100 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(tt.delay)
+				w.Write([]byte("OK"))
+			})}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- serve(ctx, server, ln, tt.drainTimeout) }()
+
+			reqErr := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+				reqErr <- err
+			}()
+			<-started
+			cancel()
+
+			if err := <-reqErr; (err != nil) != tt.wantErr {
+				t.Errorf("in-flight request error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := <-done; err != nil {
+				t.Errorf("serve() error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_newServerReadHeaderTimeout(t *testing.T) {
+	server, err := newServer(&config.AppConfiguration{ListenAddress: ":0"}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("newServer() error = %v", err)
+	}
+	if server.ReadHeaderTimeout != readHeaderTimeout {
+		t.Errorf("newServer() ReadHeaderTimeout = %v, want %v", server.ReadHeaderTimeout, readHeaderTimeout)
+	}
+}
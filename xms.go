@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+// XMS endpoints reported by xms_up, sub-collectors use the collector name
+const (
+	xmsCounters = "counters"
+	xmsLicenses = "licenses"
+)
+
+var xmsNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+var xmsV2Collectors = []string{xmsV2System, xmsV2Calls, xmsV2Conferences, xmsV2Network, xmsV2Streams}
+
+// legacyXmsTargets returns the XMS targets enabled by the xmsEnabled and
+// xmsV2Enabled configuration flags
+func legacyXmsTargets(conf *config.AppConfiguration) (targets []config.XmsTarget) {
+	if conf.XmsEnabled {
+		targets = append(targets, config.XmsTarget{Name: "xms", Version: "v1",
+			CountersURL: conf.XmsCountersURL, LicensesURL: conf.XmsLicensesURL, TLS: conf.XmsTLS})
+	}
+	if conf.XmsV2Enabled {
+		targets = append(targets, config.XmsTarget{Name: "xms_v2", Version: "v2",
+			CountersURL: conf.Xmsv2CountersURL, LicensesURL: conf.Xmsv2LicensesURL,
+			Collectors: conf.XmsV2Collectors,
+			CollectorURLs: map[string]string{
+				xmsV2System:      conf.Xmsv2SystemURL,
+				xmsV2Calls:       conf.Xmsv2CallsURL,
+				xmsV2Conferences: conf.Xmsv2ConferencesURL,
+				xmsV2Network:     conf.Xmsv2NetworkURL,
+				xmsV2Streams:     conf.Xmsv2StreamsURL,
+			},
+			TLS: conf.XmsTLS})
+	}
+	return
+}
+
+func isXmsV2Collector(name string) bool {
+	for _, c := range xmsV2Collectors {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildXmsTargets returns the legacy XMS targets and the [[xms]] entries of the
+// configuration with their default URLs and credentials
+func buildXmsTargets(conf *config.AppConfiguration) (targets []config.XmsTarget) {
+	for _, t := range append(legacyXmsTargets(conf), conf.XmsTargets...) {
+		if !xmsNameRegex.MatchString(t.Name) {
+			logError("Ignoring XMS with invalid name", t.Name)
+			continue
+		}
+		if t.Version == "" {
+			t.Version = "v1"
+		}
+		if t.Version != "v1" && t.Version != "v2" {
+			logError("Ignoring XMS", t.Name, "with unknown version", t.Version)
+			continue
+		}
+		base := strings.TrimRight(t.BaseURL, "/")
+		if t.CountersURL == "" && base != "" {
+			t.CountersURL = base + "/resource/counters"
+			if t.Version == "v2" {
+				t.CountersURL = base + "/v2/sessions"
+			}
+		}
+		if t.LicensesURL == "" && base != "" {
+			t.LicensesURL = base + "/resource/licenses"
+			if t.Version == "v2" {
+				t.LicensesURL = base + "/v2/license/stats"
+			}
+		}
+		if t.User == "" {
+			t.User = conf.XmsUser
+		}
+		if t.PwdFile != "" || t.PwdEnv != "" {
+			pwd, err := resolveSecret(t.Pwd, t.PwdFile, t.PwdEnv)
+			if err != nil {
+				logError("Ignoring XMS", t.Name, ":", err)
+				continue
+			}
+			t.Pwd = pwd
+		}
+		if t.Pwd == "" {
+			t.Pwd = conf.XmsPwd
+		}
+		if t.TLS == (config.TLSConfig{}) {
+			t.TLS = conf.XmsTLS
+		}
+
+		var collectors []string
+		urls := make(map[string]string)
+		for _, name := range t.Collectors {
+			if t.Version != "v2" || !isXmsV2Collector(name) {
+				logError("Ignoring unknown XMS", t.Version, "collector", name, "of", t.Name)
+				continue
+			}
+			url := t.CollectorURLs[name]
+			if url == "" && base != "" {
+				url = base + "/v2/" + name
+			}
+			if url == "" {
+				logError("Ignoring XMS collector", name, "of", t.Name, "without url")
+				continue
+			}
+			collectors = append(collectors, name)
+			urls[name] = url
+		}
+		t.Collectors, t.CollectorURLs = collectors, urls
+
+		if t.CountersURL == "" && t.LicensesURL == "" && len(t.Collectors) == 0 {
+			logError("Ignoring XMS", t.Name, "without baseURL or URLs")
+			continue
+		}
+		targets = append(targets, t)
+	}
+
+	for _, t := range targets {
+		logInfo("xms", t.Name, t.Version, "enabled with user", t.User)
+		if isDefaultXmsCredentials(t.User, t.Pwd) {
+			logWarn("xms", t.Name, "uses the default credentials", defaultXmsUser+"/"+defaultXmsPwd)
+		}
+		if t.CountersURL != "" {
+			logInfo("- counters url:", t.CountersURL)
+		}
+		if t.LicensesURL != "" {
+			logInfo("- licenses url:", t.LicensesURL)
+		}
+		for _, name := range t.Collectors {
+			logInfo("-", name, "url:", t.CollectorURLs[name])
+		}
+		checkTLSConfig("xms "+t.Name, t.TLS)
+	}
+	return
+}
+
+// xmsRequest requests the url of an XMS target using basic authentication,
+// responses with a status other than 200 are returned as error
+func xmsRequest(target config.XmsTarget, url string) (*http.Response, error) {
+	// The XMS certificate might require insecureSkipVerify or a serverName in case HTTPS is used
+	// Failed to connect Get "https://127.0.0.1:10443/resource/counters":
+	//   x509: cannot validate certificate for XMS because it doesn't contain any IP SANs
+	client, err := getHTTPClient(target.TLS, false)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(target.User, string(target.Pwd))
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	return resp, nil
+}
+
+func xmsAttrs(target config.XmsTarget) []MetricAttribute {
+	return []MetricAttribute{{"xms", target.Name}}
+}
+
+// setXmsUp sets xms_up{xms="<name>",endpoint="<endpoint>"}
+func setXmsUp(set *metrics.Set, target config.XmsTarget, endpoint string, up bool) {
+	attrs := append(xmsAttrs(target), MetricAttribute{"endpoint", endpoint})
+	var value uint64
+	if up {
+		value = 1
+	}
+	setMetricValue(set, buildMetricName("xms", "up", attrs), value)
+}
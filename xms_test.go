@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
+)
+
+func Test_buildXmsTargets(t *testing.T) {
+	conf := &config.AppConfiguration{
+		XmsEnabled:     true,
+		XmsUser:        "admin",
+		XmsPwd:         "secret",
+		XmsCountersURL: "http://localhost:10080/resource/counters",
+		XmsLicensesURL: "http://localhost:10080/resource/licenses",
+		XmsTargets: []config.XmsTarget{
+			{Name: "media1", Version: "v2", BaseURL: "http://media1:10080/", User: "monitor", Collectors: []string{"calls", "unknown"}},
+			{Name: "media2", BaseURL: "http://media2:10080", Collectors: []string{"calls"}},
+			{Name: "media3", Version: "v3", BaseURL: "http://media3:10080"},
+			{Name: "invalid name", BaseURL: "http://media4:10080"},
+			{Name: "media5"},
+		},
+	}
+	want := []config.XmsTarget{
+		{Name: "xms", Version: "v1", CountersURL: "http://localhost:10080/resource/counters", LicensesURL: "http://localhost:10080/resource/licenses",
+			User: "admin", Pwd: "secret", CollectorURLs: map[string]string{}},
+		{Name: "media1", Version: "v2", BaseURL: "http://media1:10080/", CountersURL: "http://media1:10080/v2/sessions", LicensesURL: "http://media1:10080/v2/license/stats",
+			User: "monitor", Pwd: "secret", Collectors: []string{"calls"}, CollectorURLs: map[string]string{"calls": "http://media1:10080/v2/calls"}},
+		{Name: "media2", Version: "v1", BaseURL: "http://media2:10080", CountersURL: "http://media2:10080/resource/counters", LicensesURL: "http://media2:10080/resource/licenses",
+			User: "admin", Pwd: "secret", CollectorURLs: map[string]string{}},
+	}
+	if got := buildXmsTargets(conf); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildXmsTargets() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_setXmsUp(t *testing.T) {
+	set := metrics.NewSet()
+	target := config.XmsTarget{Name: "media1"}
+	setXmsUp(set, target, xmsCounters, true)
+	setXmsUp(set, target, xmsLicenses, false)
+
+	var buf bytes.Buffer
+	writeMetricSets(&buf, []*metrics.Set{set})
+	want := `xms_up{xms="media1",endpoint="counters"} 1
+xms_up{xms="media1",endpoint="licenses"} 0
+`
+	if buf.String() != want {
+		t.Errorf("setXmsUp() = %q, want %q", buf.String(), want)
+	}
+}
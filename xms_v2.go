@@ -1,13 +1,16 @@
 package main
 
 import (
-	"crypto/tls"
 	"encoding/json"
-	"log"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/communi5/prometheus-c5-exporter/config"
 )
 
 // JSON struct for XMS REST API v2 (MediaServer 5.2 or newer)
@@ -40,79 +43,231 @@ type SessionUsages struct {
 }
 
 // ---------------------------- Fetch For XMS REST API v2
-func fetchXmsV2Metrics(prefix, url string, user string, pwd string, wg *sync.WaitGroup) {
+func fetchXmsV2Metrics(fc *fetchContext, target config.XmsTarget, endpoint string, wg *sync.WaitGroup) {
 	defer wg.Done()
-
-	// Disable of certificate checks required for XMS in case HTTPS is used
-	tr := &http.Transport{
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		DisableKeepAlives: true,
-	}
-	client := http.Client{Timeout: 2 * time.Second, Transport: tr}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal(err)
+	set := fc.set
+	url := target.CountersURL
+	if endpoint == xmsLicenses {
+		url = target.LicensesURL
 	}
-	req.SetBasicAuth(user, pwd)
 
-	resp, err := client.Do(req)
+	resp, err := xmsRequest(target, url)
 	if err != nil {
-		logError("Failed to connect", err)
-		setMetricValue("xms_up", 0)
+		logConnectError(fc, "Failed to connect", "err", err)
+		setXmsUp(set, target, endpoint, false)
 		return
 	}
 	defer resp.Body.Close()
+	resp.Body = io.NopCloser(debugBody(fc, url, resp.Body))
 
-	setMetricValue("xms_up", 1)
-
-	if prefix == "xms_counter" {
-		processXmsV2SessionMetrics(prefix, resp)
+	if endpoint == xmsCounters {
+		err = processXmsV2SessionMetrics(fc, "xms_counter", resp, xmsAttrs(target))
 	} else {
-		processXmsV2LicenseMetrics(prefix, resp)
+		err = processXmsV2LicenseMetrics(fc, "xms_license", resp, xmsAttrs(target))
 	}
+	if err != nil {
+		logSourceError(fc, "Failed to decode XMS response", "xms", target.Name, "endpoint", endpoint, "err", err)
+	}
+	setXmsUp(set, target, endpoint, err == nil)
 }
 
-func processXmsV2SessionMetrics(prefix string, resp *http.Response) {
+func processXmsV2SessionMetrics(fc *fetchContext, prefix string, resp *http.Response, attrs []MetricAttribute) error {
+	set := fc.set
 	val := &SessionsV2{}
 	decoder := json.NewDecoder(resp.Body)
 
 	err := decoder.Decode(val)
 	if err != nil {
-		log.Fatal(prefix, "Failed to decode XMS response:", err)
-		return
+		return err
 	}
 
-	setMetricValue(prefix + "_signaling_sessions", val.Stats.SignalingSessions)
-	setMetricValue(prefix + "_signaling_sessions_max", val.Stats.SignalingSessionsMax)
-	setMetricValue(prefix + "_fax_sessions", val.Stats.FaxSessions)
-	setMetricValue(prefix + "_fax_sessions_max", val.Stats.FaxSessionsMax)
-	setMetricValue(prefix + "_rtp_sessions", val.Stats.RtpSessions)
-	setMetricValue(prefix + "_rtp_sessions_max", val.Stats.RtpSessionsMax)
-	setMetricValue(prefix + "_speech_sessions", val.Stats.SpeechSessions)
-	setMetricValue(prefix + "_speech_sessions_max", val.Stats.SpeechSessionsMax)
-	setMetricValue(prefix + "_conference_sessions", val.Stats.ConferenceSessions)
-	setMetricValue(prefix + "_conference_sessions_max", val.Stats.ConferenceSessionsMax)
+	setMetricValue(set, buildMetricName(prefix, "signaling_sessions", attrs), val.Stats.SignalingSessions)
+	setMetricValue(set, buildMetricName(prefix, "signaling_sessions_max", attrs), val.Stats.SignalingSessionsMax)
+	setMetricValue(set, buildMetricName(prefix, "fax_sessions", attrs), val.Stats.FaxSessions)
+	setMetricValue(set, buildMetricName(prefix, "fax_sessions_max", attrs), val.Stats.FaxSessionsMax)
+	setMetricValue(set, buildMetricName(prefix, "rtp_sessions", attrs), val.Stats.RtpSessions)
+	setMetricValue(set, buildMetricName(prefix, "rtp_sessions_max", attrs), val.Stats.RtpSessionsMax)
+	setMetricValue(set, buildMetricName(prefix, "speech_sessions", attrs), val.Stats.SpeechSessions)
+	setMetricValue(set, buildMetricName(prefix, "speech_sessions_max", attrs), val.Stats.SpeechSessionsMax)
+	setMetricValue(set, buildMetricName(prefix, "conference_sessions", attrs), val.Stats.ConferenceSessions)
+	setMetricValue(set, buildMetricName(prefix, "conference_sessions_max", attrs), val.Stats.ConferenceSessionsMax)
+	return nil
 }
 
-func processXmsV2LicenseMetrics(prefix string, resp *http.Response) {
+func processXmsV2LicenseMetrics(fc *fetchContext, prefix string, resp *http.Response, attrs []MetricAttribute) error {
+	set := fc.set
 	val := &LicensesV2{}
 	decoder := json.NewDecoder(resp.Body)
 
 	err := decoder.Decode(val)
 	if err != nil {
-		log.Fatal(prefix, "Failed to decode XMS response:", err)
-		return
+		return err
 	}
 
 	for _, item := range val.LicenseUsages {
 		name := strings.ToLower(strings.ReplaceAll(item.Id, " ", "_"))
 		basename := prefix + "_" + name
 
-		setMetricValue(basename + "_free", item.Free)
-		setMetricValue(basename + "_allocated", item.Free + item.In_use)
-		setMetricValue(basename + "_total", item.Free + item.In_use)
-		setMetricValue(basename + "_used", item.In_use)
-		setMetricValue(basename + "_percent_used", item.In_use_pc)
+		setMetricValue(set, buildMetricName(basename, "free", attrs), item.Free)
+		setMetricValue(set, buildMetricName(basename, "allocated", attrs), item.Free + item.In_use)
+		setMetricValue(set, buildMetricName(basename, "total", attrs), item.Free + item.In_use)
+		setMetricValue(set, buildMetricName(basename, "used", attrs), item.In_use)
+		setMetricValue(set, buildMetricName(basename, "percent_used", attrs), item.In_use_pc)
+	}
+	return nil
+}
+
+// Optional XMS v2 sub-collectors. Lists like calls and conferences are aggregated
+// to the number of entries, system and network statistics are exported with all
+// numeric fields.
+const (
+	xmsV2System      = "system"
+	xmsV2Calls       = "calls"
+	xmsV2Conferences = "conferences"
+	xmsV2Network     = "network"
+	xmsV2Streams     = "streams"
+)
+
+// countXmsV2List returns the number of entries of a list response, which is either
+// a JSON array or an object containing the array, e.g. {"calls": [...]}
+func countXmsV2List(data interface{}) (uint64, bool) {
+	switch v := data.(type) {
+	case []interface{}:
+		return uint64(len(v)), true
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if list, ok := v[key].([]interface{}); ok {
+				return uint64(len(list)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// processXmsV2Values sets all numeric and boolean fields of a JSON response using the
+// path of the field as metric name. Objects in arrays are labelled by their name or id
+// field, otherwise by their index. The outermost arrays use the given label, nested
+// arrays are labelled by the singular of their key, e.g.
+//
+//	{"interfaces": [{"name": "eth0", "rx_packets": 10, "addresses": [{"id": "ipv4", "errors": 0}]}]}
+//
+// results in xms_network_interfaces_rx_packets{interface="eth0"} 10 and
+// xms_network_interfaces_addresses_errors{interface="eth0",address="ipv4"} 0
+func processXmsV2Values(set *metrics.Set, name, label string, data interface{}, attrs []MetricAttribute) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key == "name" || key == "id" {
+				continue
+			}
+			if field := sanitizeMetricName(key); field != "" {
+				childLabel := label
+				if hasAttribute(attrs, label) {
+					childLabel = labelName(singularLabel(field))
+				}
+				processXmsV2Values(set, name+"_"+field, childLabel, value, attrs)
+			}
+		}
+	case []interface{}:
+		// Each label must only be used once per series
+		for hasAttribute(attrs, label) {
+			label += "_idx"
+		}
+		for i, value := range v {
+			id := strconv.Itoa(i)
+			if obj, ok := value.(map[string]interface{}); ok {
+				if s, ok := obj["name"].(string); ok && s != "" {
+					id = s
+				} else if s, ok := obj["id"].(string); ok && s != "" {
+					id = s
+				}
+			}
+			tmp := append(append([]MetricAttribute{}, attrs...), MetricAttribute{label, escapeLabelValue(id)})
+			processXmsV2Values(set, name, label, value, tmp)
+		}
+	case float64:
+		setFloatMetricValue(set, buildMetricName("", name, attrs), v)
+	case bool:
+		var value uint64
+		if v {
+			value = 1
+		}
+		setMetricValue(set, buildMetricName("", name, attrs), value)
+	}
+}
+
+func hasAttribute(attrs []MetricAttribute, name string) bool {
+	for _, attr := range attrs {
+		if attr.name == name {
+			return true
+		}
 	}
-}
\ No newline at end of file
+	return false
+}
+
+// singularLabel derives the label of a nested array from its key, e.g. "address"
+// for "addresses" and "stream" for "streams"
+func singularLabel(key string) string {
+	switch {
+	case strings.HasSuffix(key, "sses"):
+		return strings.TrimSuffix(key, "es")
+	case strings.HasSuffix(key, "s") && len(key) > 1:
+		return strings.TrimSuffix(key, "s")
+	}
+	return key
+}
+
+// labelName converts a sanitized field name to a valid label name by prefixing a
+// leading digit with "_", e.g. "5g_cell" to "_5g_cell"
+func labelName(field string) string {
+	if field != "" && field[0] >= '0' && field[0] <= '9' {
+		return "_" + field
+	}
+	return field
+}
+
+// fetchXmsV2Collector fetches an optional XMS v2 sub-collector
+func fetchXmsV2Collector(fc *fetchContext, target config.XmsTarget, collector string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	set := fc.set
+
+	resp, err := xmsRequest(target, target.CollectorURLs[collector])
+	if err != nil {
+		logConnectError(fc, "Failed to connect", "err", err)
+		setXmsUp(set, target, collector, false)
+		return
+	}
+	defer resp.Body.Close()
+
+	var data interface{}
+	body := debugBody(fc, target.CollectorURLs[collector], resp.Body)
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		logSourceError(fc, "Failed to decode XMS response", "xms", target.Name, "collector", collector, "err", err)
+		setXmsUp(set, target, collector, false)
+		return
+	}
+	setXmsUp(set, target, collector, true)
+	processXmsV2Collector(fc, collector, data, xmsAttrs(target))
+}
+
+func processXmsV2Collector(fc *fetchContext, collector string, data interface{}, attrs []MetricAttribute) {
+	set := fc.set
+	switch collector {
+	case xmsV2Calls, xmsV2Conferences, xmsV2Streams:
+		count, ok := countXmsV2List(data)
+		if !ok {
+			logSourceError(fc, "Unexpected XMS response without list", "collector", collector)
+			return
+		}
+		setMetricValue(set, buildMetricName("xms", collector, attrs), count)
+	case xmsV2System:
+		processXmsV2Values(set, "xms_system", "name", data, attrs)
+	case xmsV2Network:
+		processXmsV2Values(set, "xms_network", "interface", data, attrs)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func Test_processXmsV2Collector(t *testing.T) {
+	tests := []struct {
+		name      string
+		collector string
+		body      string
+		want      string
+	}{
+		{"calls array", xmsV2Calls, `[{"id": "call1"}, {"id": "call2"}]`, "xms_calls 2\n"},
+		{"conferences object", xmsV2Conferences, `{"total": 1, "conferences": [{"id": "conf1"}]}`, "xms_conferences 1\n"},
+		{"streams without list", xmsV2Streams, `{"total": 1}`, ""},
+		{"system", xmsV2System, `{"cpu": {"usage_percent": 12.5}, "memory": {"used_bytes": 1024, "ok": true}, "version": "5.2"}`,
+			"xms_system_cpu_usage_percent 12.5\nxms_system_memory_ok 1\nxms_system_memory_used_bytes 1024\n"},
+		{"network", xmsV2Network, `{"interfaces": [{"name": "eth0", "rx-packets": 10}, {"tx_packets": 5}]}`,
+			"xms_network_interfaces_rx_packets{interface=\"eth0\"} 10\nxms_network_interfaces_tx_packets{interface=\"1\"} 5\n"},
+		{"network nested arrays", xmsV2Network, `{"interfaces": [{"name": "eth0", "addresses": [{"id": "ipv4", "errors": 1}, {"errors": 2}]}]}`,
+			"xms_network_interfaces_addresses_errors{interface=\"eth0\",address=\"1\"} 2\n" +
+				"xms_network_interfaces_addresses_errors{interface=\"eth0\",address=\"ipv4\"} 1\n"},
+		{"invalid label", xmsV2Network, `{"interfaces": [{"name": "eth0", "5g-cells": [{"id": "c1", "load": 3}]}]}`,
+			"xms_network_interfaces_5g_cells_load{interface=\"eth0\",_5g_cell=\"c1\"} 3\n"},
+		{"array of arrays", xmsV2System, `{"cpus": [[1, 2]]}`,
+			"xms_system_cpus{name=\"0\",name_idx=\"0\"} 1\nxms_system_cpus{name=\"0\",name_idx=\"1\"} 2\n"},
+		{"escaped name", xmsV2Network, `{"interfaces": [{"name": "eth\"0\\", "rx": 1}]}`,
+			"xms_network_interfaces_rx{interface=\"eth\\\"0\\\\\"} 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data interface{}
+			if err := json.Unmarshal([]byte(tt.body), &data); err != nil {
+				t.Fatal(err)
+			}
+			fc := testFetchContext()
+			processXmsV2Collector(fc, tt.collector, data, nil)
+			var buf bytes.Buffer
+			writeMetricSets(&buf, []*metrics.Set{fc.set})
+			if got := buf.String(); got != tt.want {
+				t.Errorf("processXmsV2Collector() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}